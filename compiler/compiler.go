@@ -6,11 +6,15 @@ package compiler
 import (
 	"encoding/json"
 	"fmt"
+	"path/filepath"
 	"sync"
 
 	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/ast"
 	"cuelang.org/go/cue/cuecontext"
 	"cuelang.org/go/cue/load"
+	cuejson "cuelang.org/go/encoding/json"
+	"cuelang.org/go/encoding/yaml"
 
 	"github.com/errordeveloper/cue-utils/errors"
 )
@@ -21,8 +25,9 @@ var sharedCUEMutex = &sync.Mutex{
 
 type (
 	Compiler struct {
-		ctx   *cue.Context
-		mutex *sync.Mutex
+		ctx       *cue.Context
+		mutex     *sync.Mutex
+		maxErrors int
 	}
 	Value struct {
 		cue.Value
@@ -48,20 +53,20 @@ func (c *Compiler) BuildAll(dir string, args ...string) (Value, error) {
 	}
 	loadedInstance := loadedInstances[0]
 	if loadedInstance.Err != nil {
-		return Value{}, errors.Describe(fmt.Sprintf("failed to load instances (dir: %q, args: %v)", dir, args), loadedInstance.Err)
+		return Value{}, errors.Describe(fmt.Sprintf("failed to load instances (dir: %q, args: %v)", dir, args), errors.Collect(c.maxErrors, loadedInstance.Err))
 	}
 	importPath := loadedInstance.ImportPath
 
 	builtInstances, err := c.ctx.BuildInstances(loadedInstances)
 	if err != nil {
-		return Value{}, errors.Describe(fmt.Sprintf("failed to build instances (dir: %q, args: %v)", dir, args), err)
+		return Value{}, errors.Describe(fmt.Sprintf("failed to build instances (dir: %q, args: %v)", dir, args), errors.Collect(c.maxErrors, err))
 	}
 	if len(builtInstances) != 1 {
 		return Value{}, fmt.Errorf("unexpected: more then one instance loaded")
 	}
 	builtInstance := builtInstances[0]
 	if err := builtInstance.Value().Validate(); err != nil {
-		return Value{}, errors.Describe("validation failure", err)
+		return Value{}, errors.Describe("validation failure", errors.Collect(c.maxErrors, err))
 	}
 
 	return Value{Value: builtInstance, ImportPath: importPath}, nil
@@ -73,11 +78,44 @@ func (c *Compiler) CompileString(src string, options ...cue.BuildOption) cue.Val
 	return c.ctx.CompileString(src, options...)
 }
 
+// CompileData compiles a YAML or JSON document (chosen by file extension), the
+// resulting value retains positions within the file, so errors can refer to them
+func (c *Compiler) CompileData(filename string, data []byte) (cue.Value, error) {
+	var file *ast.File
+	switch filepath.Ext(filename) {
+	case ".json":
+		expr, err := cuejson.Extract(filename, data)
+		if err != nil {
+			return cue.Value{}, errors.Describe(fmt.Sprintf("failed to parse JSON (filename: %q)", filename), err)
+		}
+		file = &ast.File{Filename: filename, Decls: []ast.Decl{&ast.EmbedDecl{Expr: expr}}}
+	default:
+		var err error
+		file, err = yaml.Extract(filename, data)
+		if err != nil {
+			return cue.Value{}, errors.Describe(fmt.Sprintf("failed to parse YAML (filename: %q)", filename), err)
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	val := c.ctx.BuildFile(file)
+	if err := val.Err(); err != nil {
+		return cue.Value{}, errors.Describe(fmt.Sprintf("failed to build value (filename: %q)", filename), err)
+	}
+	return val, nil
+}
+
 func (c *Compiler) MarshalValueJSON(v cue.Value) ([]byte, error) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	return json.Marshal(v)
 }
 
+// SetMaxErrors limits the number of errors reported at once, zero means no limit
+func (c *Compiler) SetMaxErrors(n int) { c.maxErrors = n }
+
+func (c *Compiler) MaxErrors() int { return c.maxErrors }
+
 func (c *Compiler) LockMutex()   { c.mutex.Lock() }
 func (c *Compiler) UnlockMutex() { c.mutex.Unlock() }
@@ -9,12 +9,20 @@ import (
 	"os"
 	"path/filepath"
 
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
 	"github.com/errordeveloper/cue-utils/template"
 )
 
 type Config struct {
 	BaseDirectory string
 
+	// Options apply to all templates, TemplateOptions apply to the template
+	// with the given import path, in addition to Options; this way transformers
+	// can be selected per template, those given in Options run first
+	Options         []template.Option
+	TemplateOptions map[string][]template.Option
+
 	templates map[string]*template.Generator
 }
 
@@ -37,10 +45,13 @@ func (c *Config) Load() error {
 	c.templates = map[string]*template.Generator{}
 
 	for packagePath := range packagePaths {
-		template := template.NewGenerator(packagePath)
+		template := template.New(packagePath, c.Options...)
 		if err := template.CompileAndValidate(); err != nil {
 			return fmt.Errorf("unable to load config template from %q: %w", packagePaths, err)
 		}
+		if err := template.Configure(c.TemplateOptions[template.ImportPath]...); err != nil {
+			return fmt.Errorf("unable to configure template %q: %w", template.ImportPath, err)
+		}
 		c.templates[template.ImportPath] = template
 	}
 
@@ -78,6 +89,62 @@ func (c *Config) WithDefaults(name string, obj interface{}) (*template.Generator
 	return template.WithDefaults(obj)
 }
 
+// WithDefaultsLayers merges named defaults layers for the given template,
+// see template.Generator.WithDefaultsLayers
+func (c *Config) WithDefaultsLayers(name string, layers ...template.DefaultsLayer) (*template.Generator, error) {
+	template, err := c.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return template.WithDefaultsLayers(layers...)
+}
+
+func (c *Config) WithInput(name, path string, obj interface{}) (*template.Generator, error) {
+	template, err := c.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return template.WithInput(path, obj)
+}
+
+// Inputs returns paths of all inputs accepted by the given template
+func (c *Config) Inputs(name string) ([]string, error) {
+	template, err := c.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return template.Inputs(), nil
+}
+
+// Describe returns metadata declared by the given template
+func (c *Config) Describe(name string) (template.Metadata, error) {
+	gen, err := c.Get(name)
+	if err != nil {
+		return template.Metadata{}, err
+	}
+	return gen.Metadata(), nil
+}
+
+// GenerateCRD returns a CustomResourceDefinition for resources accepted by
+// the given template
+func (c *Config) GenerateCRD(name string, options template.CRDOptions) (*unstructured.Unstructured, error) {
+	gen, err := c.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return gen.GenerateCRD(options)
+}
+
+// Typed returns the given template wrapped in a TypedGenerator, it fails if
+// In doesn't match the resource definition of the template
+func Typed[In, Out any](c *Config, name string) (*template.TypedGenerator[In, Out], error) {
+	gen, err := c.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return template.NewTypedGenerator[In, Out](gen)
+}
+
 func (c *Config) ApplyDefaults(name string, obj interface{}) error {
 	template, err := c.Get(name)
 	if err != nil {
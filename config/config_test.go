@@ -5,11 +5,16 @@
 package config_test
 
 import (
+	"context"
 	"testing"
 
 	. "github.com/onsi/gomega"
 
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
 	. "github.com/errordeveloper/cue-utils/config"
+	"github.com/errordeveloper/cue-utils/template"
+	"github.com/errordeveloper/cue-utils/template/testtypes"
 )
 
 func TestLoad(t *testing.T) {
@@ -59,3 +64,282 @@ func TestLoadWithImortPaths(t *testing.T) {
 	}
 
 }
+
+func TestLoadWithTemplateOptions(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	const slotsTemplate = "github.com/errordeveloper/cue-utils/config/testassets/slots"
+
+	c := &Config{
+		BaseDirectory: "testassets",
+		TemplateOptions: map[string][]template.Option{
+			slotsTemplate: {
+				template.WithSlots(template.Slots{
+					Template: "output",
+					Defaults: "params",
+					Resource: "input",
+				}),
+			},
+		},
+	}
+	g.Expect(c.Load()).To(Succeed())
+
+	{
+		gen, err := c.Get(slotsTemplate)
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(gen.Slots().Resource).To(Equal("input"))
+	}
+
+	{
+		gen, err := c.Get("github.com/errordeveloper/cue-utils/config/testassets/basic")
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(gen.Slots().Resource).To(Equal("resource"))
+	}
+
+	gen, err := c.WithResource(slotsTemplate, map[string]interface{}{
+		"metadata": map[string]string{"name": "foo1", "namespace": "default"},
+		"spec":     map[string]string{"location": "us-central1-a"},
+	})
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	js, err := gen.RenderJSON()
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(js).To(MatchJSON(`{
+		"kind": "ConfigMap",
+		"apiVersion": "v1",
+		"metadata": {"namespace": "default", "name": "foo1"},
+		"data": {"location": "us-central1-a"}
+	}`))
+}
+
+func TestInputs(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	const inputsTemplate = "github.com/errordeveloper/cue-utils/config/testassets/inputs"
+
+	c := &Config{BaseDirectory: "testassets"}
+	g.Expect(c.Load()).To(Succeed())
+
+	inputs, err := c.Inputs(inputsTemplate)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(inputs).To(Equal([]string{"defaults", "resource", "environment"}))
+
+	inputs, err = c.Inputs("github.com/errordeveloper/cue-utils/config/testassets/basic")
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(inputs).To(Equal([]string{"defaults", "resource"}))
+
+	gen, err := c.WithInput(inputsTemplate, "environment", "prod")
+	g.Expect(err).To(Not(HaveOccurred()))
+	js, err := gen.RenderJSON()
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(js).To(MatchJSON(`{
+		"kind": "ConfigMap",
+		"apiVersion": "v1",
+		"metadata": {"name": "environment"},
+		"data": {"value": "prod"}
+	}`))
+
+	_, err = c.WithInput("github.com/errordeveloper/cue-utils/config/testassets/basic", "environment", "prod")
+	g.Expect(err).To(HaveOccurred())
+
+	_, err = c.Inputs("nonexistent")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestTransformers(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	const (
+		slotsTemplate = "github.com/errordeveloper/cue-utils/config/testassets/slots"
+		basicTemplate = "github.com/errordeveloper/cue-utils/config/testassets/basic"
+	)
+
+	c := &Config{
+		BaseDirectory: "testassets",
+		Options: []template.Option{
+			template.WithTransformers(template.SetLabels(map[string]string{"team": "a"})),
+		},
+		TemplateOptions: map[string][]template.Option{
+			slotsTemplate: {
+				template.WithSlots(template.Slots{
+					Template: "output",
+					Defaults: "params",
+					Resource: "input",
+				}),
+				template.WithTransformers(template.SetNamespace("staging")),
+			},
+		},
+	}
+	g.Expect(c.Load()).To(Succeed())
+
+	resource := map[string]interface{}{
+		"metadata": map[string]string{"name": "foo1", "namespace": "default"},
+		"spec":     map[string]string{"location": "us-central1-a", "subnetCIDR": "10.128.0.0/16"},
+	}
+
+	{
+		gen, err := c.WithResource(slotsTemplate, resource)
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		objs, err := gen.RenderObjects()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(objs).To(HaveLen(1))
+		g.Expect(objs[0].GetLabels()).To(Equal(map[string]string{"team": "a"}))
+		g.Expect(objs[0].GetNamespace()).To(Equal("staging"))
+	}
+
+	{
+		gen, err := c.WithResource(basicTemplate, resource)
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		objs, err := gen.RenderObjects()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(objs).To(Not(BeEmpty()))
+		for _, obj := range objs {
+			g.Expect(obj.GetLabels()).To(HaveKeyWithValue("team", "a"))
+			g.Expect(obj.GetNamespace()).To(Equal("default"))
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	c := &Config{BaseDirectory: "testassets"}
+	g.Expect(c.Load()).To(Succeed())
+
+	{
+		metadata, err := c.Describe("github.com/errordeveloper/cue-utils/config/testassets/metadata")
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(metadata.DisplayName).To(Equal("Cluster config"))
+		g.Expect(metadata.Description).To(Equal("Renders a ConfigMap with cluster location"))
+		g.Expect(metadata.Owner).To(Equal("platform-team"))
+		g.Expect(metadata.Version).To(Equal("1.2.0"))
+		g.Expect(metadata.InputKind.APIVersion).To(Equal("example.com/v1"))
+		g.Expect(metadata.InputKind.Kind).To(Equal("Cluster"))
+		g.Expect(metadata.Tags).To(Equal([]string{"cluster", "gcp"}))
+	}
+
+	{
+		metadata, err := c.Describe("github.com/errordeveloper/cue-utils/config/testassets/basic")
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(metadata).To(Equal(template.Metadata{}))
+	}
+
+	{
+		_, err := c.Describe("nonexistent")
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Equal(`unknown template "nonexistent"`))
+	}
+}
+
+func TestGenerateCRD(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	c := &Config{BaseDirectory: "testassets"}
+	g.Expect(c.Load()).To(Succeed())
+
+	{
+		crd, err := c.GenerateCRD("github.com/errordeveloper/cue-utils/config/testassets/basic", template.CRDOptions{
+			Group:   "example.com",
+			Version: "v1",
+			Kind:    "Cluster",
+		})
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(crd.GetName()).To(Equal("clusters.example.com"))
+
+		versions, _, err := unstructured.NestedSlice(crd.Object, "spec", "versions")
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(versions).To(HaveLen(1))
+
+		schema, _, err := unstructured.NestedMap(versions[0].(map[string]interface{}), "schema", "openAPIV3Schema", "properties", "spec")
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(schema).To(Equal(map[string]interface{}{
+			"type":     "object",
+			"required": []interface{}{"location"},
+			"properties": map[string]interface{}{
+				"location":   map[string]interface{}{"type": "string"},
+				"subnetCIDR": map[string]interface{}{"type": "string", "nullable": true},
+			},
+		}))
+	}
+
+	{
+		_, err := c.GenerateCRD("nonexistent", template.CRDOptions{})
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Equal(`unknown template "nonexistent"`))
+	}
+}
+
+func TestProvenance(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	const slotsTemplate = "github.com/errordeveloper/cue-utils/config/testassets/slots"
+
+	c := &Config{
+		BaseDirectory: "testassets",
+		Options:       []template.Option{template.WithProvenance()},
+		TemplateOptions: map[string][]template.Option{
+			slotsTemplate: {
+				template.WithSlots(template.Slots{
+					Template: "output",
+					Defaults: "params",
+					Resource: "input",
+				}),
+			},
+		},
+	}
+	g.Expect(c.Load()).To(Succeed())
+
+	gen, err := c.WithResource(slotsTemplate, map[string]interface{}{
+		"metadata": map[string]string{"name": "foo1", "namespace": "default"},
+		"spec":     map[string]string{"location": "us-central1-a"},
+	})
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	objs, err := gen.RenderObjects()
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(objs).To(HaveLen(1))
+	g.Expect(objs[0].GetAnnotations()).To(HaveKeyWithValue(template.TemplateAnnotation, slotsTemplate))
+	g.Expect(objs[0].GetAnnotations()).To(HaveKeyWithValue(template.TemplateDigestAnnotation, gen.TemplateDigest()))
+	g.Expect(objs[0].GetAnnotations()).To(HaveKey(template.InputsDigestAnnotation))
+	g.Expect(objs[0].GetAnnotations()).To(HaveKey(template.VersionAnnotation))
+}
+
+func TestTyped(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	const basicTemplate = "github.com/errordeveloper/cue-utils/config/testassets/basic"
+
+	c := &Config{BaseDirectory: "testassets"}
+	g.Expect(c.Load()).To(Succeed())
+
+	{
+		typed, err := Typed[testtypes.Cluster, unstructured.UnstructuredList](c, basicTemplate)
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		cluster := testtypes.Cluster{}
+		cluster.Metadata.Name = "foo1"
+		cluster.Metadata.Namespace = "default"
+		cluster.Spec.Location = "us-central1-a"
+		cluster.Spec.SubnetCIDR = new(string)
+		*cluster.Spec.SubnetCIDR = "10.128.0.0/16"
+
+		list, err := typed.Render(context.Background(), cluster)
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(list.Items).To(HaveLen(3))
+		g.Expect(list.Items[0].GetName()).To(Equal("foo1"))
+	}
+
+	{
+		_, err := Typed[string, unstructured.UnstructuredList](c, basicTemplate)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(HavePrefix(`type string doesn't match "resource"`))
+	}
+
+	{
+		_, err := Typed[testtypes.Cluster, unstructured.UnstructuredList](c, "nonexistent")
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Equal(`unknown template "nonexistent"`))
+	}
+}
@@ -0,0 +1,18 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package inputs
+
+#slots: inputs: ["environment"]
+
+defaults: {}
+resource: {}
+
+environment: "dev" | "staging" | "prod"
+
+template: {
+	kind:       "ConfigMap"
+	apiVersion: "v1"
+	metadata: name: "environment"
+	data: value: environment
+}
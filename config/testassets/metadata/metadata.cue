@@ -0,0 +1,20 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package metadata
+
+#meta: {
+	displayName: "Cluster config"
+	description: "Renders a ConfigMap with cluster location"
+	owner:       "platform-team"
+	version:     "1.2.0"
+	inputKind: {
+		apiVersion: "example.com/v1"
+		kind:       "Cluster"
+	}
+	tags: ["cluster", "gcp"]
+}
+
+defaults: {}
+resource: {}
+template: {}
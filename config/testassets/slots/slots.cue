@@ -0,0 +1,20 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package slots
+
+// slot names are only set via config.TemplateOptions
+params: {}
+input: {
+	metadata: {
+		name:      string
+		namespace: string
+	}
+	spec: location: string
+}
+output: {
+	kind:       "ConfigMap"
+	apiVersion: "v1"
+	metadata:   input.metadata
+	data: location: input.spec.location
+}
@@ -6,7 +6,23 @@ import (
 	"cuelang.org/go/cue/errors"
 )
 
+type describedError struct {
+	desc string
+	err  error
+}
+
+func (e *describedError) Error() string {
+	if l, ok := e.err.(*List); ok {
+		return fmt.Sprintf("%s: %s", e.desc, l.Error())
+	}
+	msg := errors.Details(e.err, &errors.Config{})
+	return fmt.Sprintf("%s: %s", e.desc, msg)
+}
+
+func (e *describedError) Unwrap() error { return e.err }
+
+// Describe prefixes the detailed text of err with desc, the original error
+// remains accessible via errors.Unwrap
 func Describe(desc string, err error) error {
-	msg := errors.Details(err, &errors.Config{})
-	return fmt.Errorf("%s: %s", desc, msg)
+	return &describedError{desc: desc, err: err}
 }
@@ -0,0 +1,427 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package errors_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"cuelang.org/go/cue"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	. "github.com/errordeveloper/cue-utils/errors"
+	"github.com/errordeveloper/cue-utils/template"
+)
+
+func TestFieldErrorList(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	gen := template.NewGenerator("./testassets")
+	g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+	{
+		_, err := gen.WithResource(map[string]interface{}{
+			"foo": "bar",
+		})
+		g.Expect(err).To(HaveOccurred())
+
+		errs := FieldErrorList(err, "resource")
+		g.Expect(errs).To(HaveLen(1))
+		g.Expect(errs[0].Type).To(Equal(field.ErrorTypeForbidden))
+		g.Expect(errs[0].Field).To(Equal("foo"))
+	}
+
+	{
+		_, err := gen.WithResource(map[string]interface{}{
+			"spec": map[string]interface{}{
+				"mode": "Custom",
+			},
+		})
+		g.Expect(err).To(HaveOccurred())
+
+		errs := FieldErrorList(err, "resource")
+		g.Expect(errs).To(HaveLen(1))
+		g.Expect(errs[0].Type).To(Equal(field.ErrorTypeNotSupported))
+		g.Expect(errs[0].Field).To(Equal("spec.mode"))
+		g.Expect(errs[0].BadValue).To(Equal("Custom"))
+		g.Expect(errs[0].Detail).To(Equal(`supported values: "Standard", "Autopilot"`))
+	}
+
+	{
+		_, err := gen.WithResource(map[string]interface{}{
+			"spec": map[string]interface{}{
+				"subnet": "192.168.0.0/16",
+			},
+		})
+		g.Expect(err).To(HaveOccurred())
+
+		errs := FieldErrorList(err, "resource")
+		g.Expect(errs).To(HaveLen(1))
+		g.Expect(errs[0].Type).To(Equal(field.ErrorTypeInvalid))
+		g.Expect(errs[0].Field).To(Equal("spec.subnet"))
+		g.Expect(errs[0].BadValue).To(Equal("192.168.0.0/16"))
+	}
+
+	{
+		_, err := gen.WithResource(map[string]interface{}{
+			"spec": map[string]interface{}{
+				"labels": map[string]interface{}{
+					"example.com/foo": 1,
+				},
+			},
+		})
+		g.Expect(err).To(HaveOccurred())
+
+		errs := FieldErrorList(err, "resource")
+		g.Expect(errs).To(HaveLen(1))
+		g.Expect(errs[0].Type).To(Equal(field.ErrorTypeInvalid))
+		g.Expect(errs[0].Field).To(Equal("spec.labels[example.com/foo]"))
+	}
+
+	{
+		_, err := gen.WithResource(0)
+		g.Expect(err).To(HaveOccurred())
+
+		errs := FieldErrorList(err, "resource")
+		g.Expect(errs).To(HaveLen(1))
+		g.Expect(errs[0].Type).To(Equal(field.ErrorTypeInvalid))
+		g.Expect(errs[0].Field).To(Equal("resource"))
+	}
+
+	{
+		withResource, err := gen.WithResource(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name": "foo",
+			},
+		})
+		g.Expect(err).ToNot(HaveOccurred())
+
+		_, err = withResource.RenderJSON()
+		g.Expect(err).To(HaveOccurred())
+
+		errs := FieldErrorList(err, "resource")
+		g.Expect(errs).ToNot(BeEmpty())
+		g.Expect(errs[0].Type).To(Equal(field.ErrorTypeRequired))
+		g.Expect(errs[0].Field).To(Equal("template.metadata.namespace"))
+	}
+
+	{
+		// incomplete values behind string interpolation are classified by their cause
+		gen := template.NewGenerator("../template/testassets")
+		g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+		withResource, err := gen.WithResource(map[string]string{})
+		g.Expect(err).ToNot(HaveOccurred())
+
+		_, err = withResource.RenderJSON()
+		g.Expect(err).To(HaveOccurred())
+
+		errs := FieldErrorList(err, "resource")
+		g.Expect(errs).To(ContainElement(field.Required(field.NewPath("template", "items").Index(0).Child("metadata", "namespace"), "")))
+		for _, e := range errs {
+			if strings.HasPrefix(e.Field, "template.") {
+				g.Expect(e.Type).To(Equal(field.ErrorTypeRequired))
+			}
+			g.Expect(e.Detail).ToNot(Equal("invalid interpolation"))
+		}
+	}
+
+	g.Expect(FieldErrorList(nil, "resource")).To(BeEmpty())
+}
+
+func TestCollect(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	gen := template.NewGenerator("./testassets")
+	g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+	invalidResource := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name": 1,
+		},
+		"spec": map[string]interface{}{
+			"subnet": "192.168.0.0/16",
+			"nodes":  0,
+			"foo":    "bar",
+		},
+	}
+
+	{
+		_, err := gen.WithResource(invalidResource)
+		g.Expect(err).To(HaveOccurred())
+
+		var l *List
+		g.Expect(errors.As(err, &l)).To(BeTrue())
+		g.Expect(l.Len()).To(Equal(4))
+		g.Expect(l.Omitted()).To(BeZero())
+
+		paths := []string{}
+		for _, e := range l.Errors() {
+			paths = append(paths, strings.Join(e.Path(), "."))
+		}
+		g.Expect(paths).To(Equal([]string{
+			"resource.metadata.name",
+			"resource.spec",
+			"resource.spec.subnet",
+			"resource.spec.nodes",
+		}))
+
+		g.Expect(FieldErrorList(err, "resource")).To(HaveLen(4))
+	}
+
+	{
+		withResource, err := gen.WithResource(map[string]interface{}{})
+		g.Expect(err).ToNot(HaveOccurred())
+
+		_, err = withResource.RenderJSON()
+		g.Expect(err).To(HaveOccurred())
+
+		var l *List
+		g.Expect(errors.As(err, &l)).To(BeTrue())
+		g.Expect(l.Len()).To(Equal(5))
+	}
+
+	{
+		gen.Compiler().SetMaxErrors(2)
+		defer gen.Compiler().SetMaxErrors(0)
+
+		_, err := gen.WithResource(invalidResource)
+		g.Expect(err).To(HaveOccurred())
+
+		var l *List
+		g.Expect(errors.As(err, &l)).To(BeTrue())
+		g.Expect(l.Len()).To(Equal(2))
+		g.Expect(l.Omitted()).To(Equal(2))
+		g.Expect(err.Error()).To(HaveSuffix("(and 2 more errors)\n"))
+	}
+
+	{
+		// the same errors from a definition referenced in multiple places are only reported once
+		gen := template.NewGenerator("../template/testassets/lists")
+		g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+		_, err := gen.RenderJSON()
+		g.Expect(err).To(HaveOccurred())
+
+		var l *List
+		g.Expect(errors.As(err, &l)).To(BeTrue())
+		g.Expect(l.Len()).To(Equal(2))
+
+		paths := []string{}
+		for _, e := range l.Errors() {
+			paths = append(paths, strings.Join(e.Path(), "."))
+		}
+		g.Expect(paths).To(Equal([]string{
+			"template.0.items.0.metadata.name",
+			"template.0.items.0.metadata.namespace",
+		}))
+	}
+
+	g.Expect(Collect(0).Err()).ToNot(HaveOccurred())
+}
+
+func TestCustomMessages(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	gen := template.NewGenerator("./testassets")
+	g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+	{
+		_, err := gen.WithResource(map[string]interface{}{
+			"spec": map[string]interface{}{
+				"subnet": "192.168.0.0/16",
+			},
+		})
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(HavePrefix(`unable to fill path "resource": resource.spec.subnet: subnet must be within 10.0.0.0/8:` + "\n"))
+		g.Expect(err.Error()).To(ContainSubstring("errors/testassets/testassets.cue:13:"))
+
+		errs := FieldErrorList(err, "resource")
+		g.Expect(errs).To(HaveLen(1))
+		g.Expect(errs[0].Type).To(Equal(field.ErrorTypeInvalid))
+		g.Expect(errs[0].Field).To(Equal("spec.subnet"))
+		g.Expect(errs[0].BadValue).To(Equal("192.168.0.0/16"))
+		g.Expect(errs[0].Detail).To(Equal("subnet must be within 10.0.0.0/8"))
+	}
+
+	{
+		_, err := gen.WithResource(map[string]interface{}{
+			"spec": map[string]interface{}{
+				"tier": "bronze",
+			},
+		})
+		g.Expect(err).To(HaveOccurred())
+
+		var l *List
+		g.Expect(errors.As(err, &l)).To(BeTrue())
+		g.Expect(l.Len()).To(Equal(1))
+		g.Expect(l.Errors()[0].Path()).To(Equal([]string{"resource", "spec", "tier"}))
+		g.Expect(l.Errors()[0].Error()).To(Equal("resource.spec.tier: tier must be either gold or silver"))
+
+		errs := FieldErrorList(err, "resource")
+		g.Expect(errs).To(HaveLen(1))
+		g.Expect(errs[0].Type).To(Equal(field.ErrorTypeNotSupported))
+		g.Expect(errs[0].Field).To(Equal("spec.tier"))
+		g.Expect(errs[0].BadValue).To(Equal("bronze"))
+		g.Expect(errs[0].Detail).To(Equal("tier must be either gold or silver"))
+	}
+}
+
+func TestSuggestions(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	{
+		gen := template.NewGenerator("../template/testassets")
+		g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+		_, err := gen.WithResource(map[string]interface{}{
+			"spec": map[string]interface{}{
+				"location":   "us-central1-a",
+				"subnetCidr": "10.128.0.0/16",
+			},
+		})
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(HavePrefix(`unable to fill path "resource": resource.spec: field not allowed: subnetCidr (did you mean subnetCIDR?):`))
+
+		errs := FieldErrorList(err, "resource")
+		g.Expect(errs).To(HaveLen(1))
+		g.Expect(errs[0].Type).To(Equal(field.ErrorTypeForbidden))
+		g.Expect(errs[0].Field).To(Equal("spec.subnetCidr"))
+		g.Expect(errs[0].Detail).To(Equal("field not allowed, did you mean subnetCIDR?"))
+	}
+
+	gen := template.NewGenerator("./testassets")
+	g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+	{
+		_, err := gen.WithResource(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"nme":       "foo",
+				"namespace": "default",
+			},
+		})
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(HavePrefix(`unable to fill path "resource": resource.metadata: field not allowed: nme (did you mean name?):`))
+	}
+
+	{
+		_, err := gen.WithResource(map[string]interface{}{
+			"spec": map[string]interface{}{
+				"subnt":  "10.0.0.0/8",
+				"subnet": "10.0.0.0/8",
+				"tire":   "gold",
+			},
+		})
+		g.Expect(err).To(HaveOccurred())
+
+		var l *List
+		g.Expect(errors.As(err, &l)).To(BeTrue())
+		g.Expect(l.Len()).To(Equal(2))
+		g.Expect(l.Errors()[0].Error()).To(Equal("resource.spec: field not allowed: subnt (did you mean subnet?)"))
+		g.Expect(l.Errors()[1].Error()).To(Equal("resource.spec: field not allowed: tire (did you mean tier?)"))
+	}
+
+	{
+		_, err := gen.WithResource(map[string]interface{}{
+			"foo": "bar",
+		})
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(HavePrefix(`unable to fill path "resource": resource: field not allowed: foo:`))
+	}
+}
+
+func TestRedact(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	always := func(cue.Path) bool { return true }
+
+	g.Expect(Redact(nil, always)).To(BeNil())
+
+	{
+		// errors without a path are returned as is
+		err := errors.New("password hunter2 is invalid")
+		g.Expect(Redact(err, nil)).To(BeIdenticalTo(err))
+		g.Expect(Redact(err, always)).To(BeIdenticalTo(err))
+
+		described := Describe("unable to use hunter2", err)
+		g.Expect(Redact(described, always).Error()).To(Equal("unable to use hunter2: password hunter2 is invalid\n"))
+	}
+
+	gen := template.NewGenerator("../template/testassets/sensitive")
+	g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+	{
+		// only arguments of messages at sensitive paths are redacted, even
+		// a single character secret doesn't affect the rest of the message
+		_, err := gen.WithResource(map[string]interface{}{
+			"spec": map[string]interface{}{
+				"username": 5,
+				"password": "e",
+			},
+		})
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(HavePrefix(`unable to fill path "resource": `))
+		g.Expect(err.Error()).To(ContainSubstring(`resource.spec.password: invalid value <redacted> (out of bound <redacted>)`))
+		g.Expect(err.Error()).To(ContainSubstring(`resource.spec.username: conflicting values string and 5`))
+		g.Expect(err.Error()).To(Not(ContainSubstring(`"e"`)))
+
+		errs := FieldErrorList(err, "resource")
+		g.Expect(errs).To(HaveLen(2))
+		for _, fieldErr := range errs {
+			switch fieldErr.Field {
+			case "spec.password":
+				g.Expect(fieldErr.Type).To(Equal(field.ErrorTypeInvalid))
+				g.Expect(fieldErr.BadValue).To(Equal("<redacted>"))
+			case "spec.username":
+				g.Expect(fieldErr.Type).To(Equal(field.ErrorTypeInvalid))
+				g.Expect(fieldErr.BadValue).To(Equal("5"))
+			default:
+				t.Errorf("unexpected field %q", fieldErr.Field)
+			}
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	inResource := func(path []string) bool { return len(path) != 0 && path[0] == "resource" }
+	outsideResource := func(path []string) bool { return !inResource(path) }
+
+	g.Expect(Filter(nil, inResource)).To(BeNil())
+
+	{
+		err := errors.New("unknown output")
+		g.Expect(Filter(err, inResource)).To(BeNil())
+		g.Expect(Filter(err, outsideResource)).To(BeIdenticalTo(err))
+	}
+
+	gen := template.NewGenerator("../template/testassets/sensitive")
+	g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+	gen, err := gen.WithResource(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"username": "admin",
+			"password": "s3cr3t-pass",
+		},
+	})
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	_, err = gen.RenderJSON()
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(Filter(err, inResource)).To(BeNil())
+
+	filtered := Filter(err, outsideResource)
+	g.Expect(filtered).To(HaveOccurred())
+	g.Expect(filtered.Error()).To(Equal(err.Error()))
+
+	errs := FieldErrorList(Filter(err, func(path []string) bool {
+		return strings.Join(path, ".") == "template.metadata.name"
+	}), "resource")
+	g.Expect(errs).To(HaveLen(1))
+	g.Expect(errs[0].Field).To(Equal("template.metadata.name"))
+}
@@ -0,0 +1,194 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package errors
+
+import (
+	stderrors "errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	msgIncompleteValue        = "incomplete value %v"
+	msgCannotConvert          = "cannot convert incomplete value %q to JSON"
+	msgNonConcrete            = "non-concrete value %s (type %s)"
+	msgEmptyDisjunction       = "%d errors in empty disjunction:"
+	msgConflictingValues      = "conflicting values %s and %s"
+	msgConflictingValuesTypes = "conflicting values %s and %s (mismatched types %s and %s)"
+	msgOutOfBound             = "invalid value %v (out of bound %s)"
+	msgFieldNotAllowed        = "field not allowed: %s"
+	msgMoreErrors             = "%s (and %d more errors)"
+)
+
+// FieldErrorList converts CUE evaluation errors (e.g. returned by WithResource
+// or RenderJSON) to a Kubernetes field.ErrorList; paths are taken relative to
+// the given slot (e.g. "resource"), errors outside of it keep the full path
+func FieldErrorList(err error, slot string) field.ErrorList {
+	if err == nil {
+		return nil
+	}
+
+	var cueErr errors.Error
+	var l *List
+	if !stderrors.As(err, &cueErr) && !stderrors.As(err, &l) {
+		return field.ErrorList{field.InternalError(field.NewPath(slot), err)}
+	}
+
+	// errors with a custom message are classified according to the
+	// original errors, only the detail is replaced
+	cueErrs := []errors.Error{}
+	customMessages := []string{}
+	for _, e := range cueErrors(err) {
+		if custom, ok := e.(*customMessageError); ok {
+			for _, cause := range custom.causes {
+				cueErrs = append(cueErrs, cause)
+				customMessages = append(customMessages, custom.msg)
+			}
+			continue
+		}
+		cueErrs = append(cueErrs, e)
+		customMessages = append(customMessages, "")
+	}
+
+	// conflicts that make up an empty disjunction are reported together
+	// with it, regardless of how the errors have been sorted
+	disjuncts := map[int][]errors.Error{}
+	consumed := make([]bool, len(cueErrs))
+	for i, e := range cueErrs {
+		if format, _ := rootError(e).Msg(); format != msgEmptyDisjunction {
+			continue
+		}
+		for j, d := range cueErrs {
+			if format, _ := rootError(d).Msg(); format == msgConflictingValues && !consumed[j] && equalPath(e.Path(), d.Path()) {
+				disjuncts[i] = append(disjuncts[i], d)
+				consumed[j] = true
+			}
+		}
+	}
+
+	list := field.ErrorList{}
+	seen := map[string]struct{}{}
+	add := func(i int, fieldErr *field.Error) {
+		if customMessages[i] != "" {
+			fieldErr.Detail = customMessages[i]
+		}
+		key := fieldErr.Error()
+		if _, ok := seen[key]; ok {
+			return
+		}
+		seen[key] = struct{}{}
+		list = append(list, fieldErr)
+	}
+
+	for i, e := range cueErrs {
+		if consumed[i] {
+			continue
+		}
+		// wrappers like "invalid interpolation" are classified by their cause
+		format, args := rootError(e).Msg()
+		fldPath := toFieldPath(e.Path(), slot)
+
+		switch format {
+		case msgIncompleteValue, msgCannotConvert, msgNonConcrete:
+			add(i, field.Required(fldPath, ""))
+		case msgFieldNotAllowed:
+			add(i, field.Forbidden(toFieldPath(append(e.Path(), fmt.Sprint(args...)), slot), "field not allowed"))
+		case msgFieldNotAllowedSuggestions:
+			add(i, field.Forbidden(toFieldPath(append(e.Path(), fmt.Sprint(args[0])), slot), fmt.Sprintf("field not allowed, did you mean %s?", args[1])))
+		case msgEmptyDisjunction:
+			if value, validValues, ok := notSupported(disjuncts[i]); ok {
+				add(i, field.NotSupported(fldPath, value, validValues))
+			} else {
+				add(i, field.Invalid(fldPath, nil, "no matching values in disjunction"))
+			}
+		case msgConflictingValues, msgConflictingValuesTypes:
+			add(i, field.Invalid(fldPath, unquote(args[1]), fmt.Sprintf(format, args...)))
+		case msgOutOfBound:
+			add(i, field.Invalid(fldPath, unquote(args[0]), fmt.Sprintf(format, args...)))
+		default:
+			add(i, field.Invalid(fldPath, nil, fmt.Sprintf(format, args...)))
+		}
+	}
+	return list
+}
+
+// notSupported checks that each disjunct failed due to a conflict with a
+// concrete value, which means the field is an enum
+func notSupported(disjuncts []errors.Error) (interface{}, []string, bool) {
+	if len(disjuncts) == 0 {
+		return nil, nil, false
+	}
+	var value interface{}
+	validValues := make([]string, 0, len(disjuncts))
+	for _, d := range disjuncts {
+		_, args := rootError(d).Msg()
+		if len(args) != 2 {
+			return nil, nil, false
+		}
+		validValues = append(validValues, fmt.Sprint(unquote(args[0])))
+		value = unquote(args[1])
+	}
+	return value, validValues, true
+}
+
+func toFieldPath(cuePath []string, slot string) *field.Path {
+	if len(cuePath) > 0 && cuePath[0] == slot {
+		cuePath = cuePath[1:]
+	}
+	if len(cuePath) == 0 {
+		return field.NewPath(slot)
+	}
+
+	var fldPath *field.Path
+	for _, elem := range cuePath {
+		switch {
+		case fldPath == nil:
+			fldPath = field.NewPath(fmt.Sprint(unquote(elem)))
+		case isIndex(elem):
+			index, _ := strconv.Atoi(elem)
+			fldPath = fldPath.Index(index)
+		case strings.HasPrefix(elem, `"`):
+			fldPath = fldPath.Key(fmt.Sprint(unquote(elem)))
+		default:
+			fldPath = fldPath.Child(elem)
+		}
+	}
+	return fldPath
+}
+
+func isIndex(elem string) bool {
+	if elem == "" {
+		return false
+	}
+	for _, c := range elem {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func unquote(v interface{}) interface{} {
+	s := fmt.Sprint(v)
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		return unquoted
+	}
+	return s
+}
+
+func equalPath(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
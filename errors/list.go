@@ -0,0 +1,269 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package errors
+
+import (
+	stderrors "errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/errors"
+	"cuelang.org/go/cue/token"
+)
+
+// List holds every independent error reported by CUE, sorted by position
+// and with duplicates removed
+type List struct {
+	errs    []errors.Error
+	omitted int
+}
+
+// Collect gathers all errors from errs into a List, duplicates that arise
+// from the same definition being referenced in multiple places are dropped;
+// when limit is greater than zero only the first limit errors are retained
+func Collect(limit int, errs ...error) *List {
+	return collect(nil, limit, errs...)
+}
+
+func collect(v *cue.Value, limit int, errs ...error) *List {
+	all := []errors.Error{}
+	for _, err := range errs {
+		all = append(all, cueErrors(err)...)
+	}
+
+	// errors reported without their cause (as by MarshalJSON) are dropped,
+	// if the same error was also reported with the cause
+	wrapped := map[string]struct{}{}
+	for _, e := range all {
+		if rootError(e) != e {
+			wrapped[wrapperKey(e)] = struct{}{}
+		}
+	}
+
+	l := &List{}
+	seen := map[string]struct{}{}
+	for _, e := range all {
+		if _, ok := wrapped[wrapperKey(e)]; ok && rootError(e) == e {
+			continue
+		}
+		key := dedupKey(e)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		l.errs = append(l.errs, e)
+	}
+
+	if v != nil {
+		l.errs = withSuggestions(*v, l.errs)
+		l.errs = withCustomMessages(*v, l.errs)
+	}
+
+	sort.SliceStable(l.errs, func(i, j int) bool {
+		return comparePos(position(l.errs[i]), position(l.errs[j])) < 0
+	})
+
+	if limit > 0 && len(l.errs) > limit {
+		l.omitted = len(l.errs) - limit
+		l.errs = l.errs[:limit]
+	}
+	return l
+}
+
+// Errors returns the errors in the list
+func (l *List) Errors() []errors.Error { return l.errs }
+
+// Len returns the number of errors in the list, not counting omitted ones
+func (l *List) Len() int { return len(l.errs) }
+
+// Omitted returns the number of errors that were dropped due to the limit
+func (l *List) Omitted() int { return l.omitted }
+
+// Err returns nil if the list is empty, otherwise the list itself
+func (l *List) Err() error {
+	if len(l.errs) == 0 {
+		return nil
+	}
+	return l
+}
+
+// Filter returns the CUE errors within err with paths for which keep returns
+// true, lists and descriptions retain their structure; any other errors are
+// retained if keep returns true for an empty path; nil is returned if no
+// errors are left
+func Filter(err error, keep func(path []string) bool) error {
+	switch err := err.(type) {
+	case nil:
+		return nil
+	case *List:
+		return filterAll(err.errs, err.omitted, keep)
+	case *describedError:
+		if filtered := Filter(err.err, keep); filtered != nil {
+			return &describedError{desc: err.desc, err: filtered}
+		}
+		return nil
+	case errors.Error:
+		if errs := errors.Errors(err); len(errs) > 1 {
+			return filterAll(errs, 0, keep)
+		}
+		if keep(err.Path()) {
+			return err
+		}
+		return nil
+	default:
+		if keep(nil) {
+			return err
+		}
+		return nil
+	}
+}
+
+func filterAll(errs []errors.Error, omitted int, keep func(path []string) bool) error {
+	l := &List{omitted: omitted}
+	for _, e := range errs {
+		if keep(e.Path()) {
+			l.errs = append(l.errs, e)
+		}
+	}
+	return l.Err()
+}
+
+// Unwrap allows errors.Is and errors.As to match any of the errors
+func (l *List) Unwrap() []error {
+	errs := make([]error, len(l.errs))
+	for i := range l.errs {
+		errs[i] = l.errs[i]
+	}
+	return errs
+}
+
+func (l *List) Error() string {
+	w := &strings.Builder{}
+	for _, e := range l.errs {
+		errors.Print(w, e, &errors.Config{})
+	}
+	if l.omitted > 0 {
+		fmt.Fprintf(w, "(and %d more errors)\n", l.omitted)
+	}
+	return w.String()
+}
+
+// cueErrors expands err into individual CUE errors, including those
+// nested in a List or only summarised by an error (as returned by MarshalJSON)
+func cueErrors(err error) []errors.Error {
+	if err == nil {
+		return nil
+	}
+
+	var l *List
+	if stderrors.As(err, &l) {
+		return l.errs
+	}
+
+	var cueErr errors.Error
+	if !stderrors.As(err, &cueErr) {
+		return []errors.Error{errors.Promote(err, "")}
+	}
+
+	result := []errors.Error{}
+	for _, e := range errors.Errors(cueErr) {
+		format, args := e.Msg()
+		if format == msgMoreErrors && len(args) == 2 {
+			if first, ok := args[0].(errors.Error); ok {
+				result = append(result, cueErrors(first)...)
+				continue
+			}
+		}
+		result = append(result, e)
+	}
+	return result
+}
+
+// dedupKey identifies an error by the message of its cause and its positions,
+// so that the same error reached via different paths (e.g. from a definition
+// that is referenced in multiple places) is only reported once; errors
+// without positions are identified by their path
+func dedupKey(e errors.Error) string {
+	positions := positionsOf(rootError(e))
+	if len(positions) == 0 {
+		return strings.Join(e.Path(), ".") + ": " + rootMsg(e)
+	}
+	return strings.Join(positions, ",") + ": " + rootMsg(e)
+}
+
+func wrapperKey(e errors.Error) string {
+	format, args := e.Msg()
+	return strings.Join(e.Path(), ".") + " " + strings.Join(positionsOf(e), ",") + ": " + fmt.Sprintf(format, args...)
+}
+
+// positionsOf returns sorted unique positions of an error
+func positionsOf(e errors.Error) []string {
+	unique := map[string]struct{}{}
+	for _, pos := range append([]token.Pos{e.Position()}, e.InputPositions()...) {
+		if pos != token.NoPos {
+			unique[pos.String()] = struct{}{}
+		}
+	}
+	positions := make([]string, 0, len(unique))
+	for pos := range unique {
+		positions = append(positions, pos)
+	}
+	sort.Strings(positions)
+	return positions
+}
+
+// rootError returns the innermost error, wrappers like "invalid interpolation"
+// merely repeat the cause
+func rootError(e errors.Error) errors.Error {
+	for {
+		next, ok := stderrors.Unwrap(e).(errors.Error)
+		if !ok {
+			return e
+		}
+		e = next
+	}
+}
+
+// rootMsg returns the message of the innermost error, so that incomplete
+// values reported by MarshalJSON and by Validate compare equal
+func rootMsg(e errors.Error) string {
+	format, args := rootError(e).Msg()
+	switch format {
+	case msgCannotConvert, msgNonConcrete:
+		format, args = msgIncompleteValue, args[:1]
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+func position(e errors.Error) token.Pos {
+	if pos := e.Position(); pos != token.NoPos {
+		return pos
+	}
+	if inputs := e.InputPositions(); len(inputs) > 0 {
+		return inputs[0]
+	}
+	return token.NoPos
+}
+
+// comparePos orders positions by file, line and column, errors without
+// a position go last
+func comparePos(a, b token.Pos) int {
+	switch {
+	case a == b:
+		return 0
+	case a == token.NoPos:
+		return 1
+	case b == token.NoPos:
+		return -1
+	}
+	if a.Filename() != b.Filename() {
+		return strings.Compare(a.Filename(), b.Filename())
+	}
+	if a.Line() != b.Line() {
+		return a.Line() - b.Line()
+	}
+	return a.Column() - b.Column()
+}
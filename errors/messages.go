@@ -0,0 +1,92 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package errors
+
+import (
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/errors"
+	"cuelang.org/go/cue/token"
+)
+
+// messageAttr is the attribute template authors can use to replace the
+// message of any error on a field, e.g. @error("subnet must be a /20 or larger")
+const messageAttr = "error"
+
+// customMessageError keeps the path and positions of the first error
+// reported for a field, but replaces the message with the one declared
+// in the template; all of the original errors are retained as causes
+type customMessageError struct {
+	msg    string
+	causes []errors.Error
+}
+
+func (e *customMessageError) Position() token.Pos          { return e.causes[0].Position() }
+func (e *customMessageError) InputPositions() []token.Pos  { return e.causes[0].InputPositions() }
+func (e *customMessageError) Path() []string               { return e.causes[0].Path() }
+func (e *customMessageError) Msg() (string, []interface{}) { return "%s", []interface{}{e.msg} }
+func (e *customMessageError) Error() string                { return errors.String(e) }
+
+// CollectFrom is like Collect, but messages of errors on fields of v
+// that carry an @error attribute are replaced with the attribute value
+func CollectFrom(v cue.Value, limit int, errs ...error) *List {
+	return collect(&v, limit, errs...)
+}
+
+func withCustomMessages(v cue.Value, errs []errors.Error) []errors.Error {
+	result := make([]errors.Error, 0, len(errs))
+	custom := map[string]*customMessageError{}
+	for _, e := range errs {
+		msg, ok := customMessage(v, e.Path())
+		if !ok {
+			result = append(result, e)
+			continue
+		}
+		key := strings.Join(e.Path(), ".")
+		if existing, ok := custom[key]; ok {
+			existing.causes = append(existing.causes, e)
+			continue
+		}
+		custom[key] = &customMessageError{msg: msg, causes: []errors.Error{e}}
+		result = append(result, custom[key])
+	}
+	return result
+}
+
+func customMessage(v cue.Value, path []string) (string, bool) {
+	if len(path) == 0 {
+		return "", false
+	}
+	field := v.LookupPath(toCUEPath(path))
+	if !field.Exists() {
+		return "", false
+	}
+	attr := field.Attribute(messageAttr)
+	msg, err := attr.String(0)
+	if err != nil || msg == "" {
+		return "", false
+	}
+	return msg, true
+}
+
+func toCUEPath(path []string) cue.Path {
+	selectors := make([]cue.Selector, 0, len(path))
+	for _, elem := range path {
+		switch {
+		case isIndex(elem):
+			index, _ := strconv.Atoi(elem)
+			selectors = append(selectors, cue.Index(index))
+		case strings.HasPrefix(elem, "#"):
+			selectors = append(selectors, cue.Def(elem))
+		default:
+			if unquoted, err := strconv.Unquote(elem); err == nil {
+				elem = unquoted
+			}
+			selectors = append(selectors, cue.Str(elem))
+		}
+	}
+	return cue.MakePath(selectors...)
+}
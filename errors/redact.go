@@ -0,0 +1,89 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package errors
+
+import (
+	stderrors "errors"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/errors"
+	"cuelang.org/go/cue/token"
+)
+
+// Redacted replaces sensitive values in error messages
+const Redacted = "<redacted>"
+
+// redactedError keeps the path and positions of a CUE error, but replaces
+// all arguments of its message
+type redactedError struct {
+	err errors.Error
+}
+
+func (e *redactedError) Position() token.Pos         { return e.err.Position() }
+func (e *redactedError) InputPositions() []token.Pos { return e.err.InputPositions() }
+func (e *redactedError) Path() []string              { return e.err.Path() }
+func (e *redactedError) Error() string               { return errors.String(e) }
+
+// Msg retains the format, so that errors can still be classified, only
+// arguments are replaced, as these may contain values
+func (e *redactedError) Msg() (string, []interface{}) {
+	format, args := e.err.Msg()
+	redacted := make([]interface{}, len(args))
+	for i := range args {
+		redacted[i] = Redacted
+	}
+	return format, redacted
+}
+
+// Unwrap redacts the wrapped error as well, so that the root cause can still
+// be classified without disclosing any values
+func (e *redactedError) Unwrap() error {
+	if next, ok := stderrors.Unwrap(e.err).(errors.Error); ok {
+		return &redactedError{err: next}
+	}
+	return nil
+}
+
+// Redact replaces arguments of messages of CUE errors in err with Redacted,
+// where the path of the error is sensitive according to the given function;
+// lists of errors, described errors and CUE errors retain their structure,
+// descriptions and any other errors are returned as is, as they don't have
+// a path
+func Redact(err error, sensitive func(cue.Path) bool) error {
+	if err == nil || sensitive == nil {
+		return err
+	}
+	return redact(err, sensitive)
+}
+
+func redact(err error, sensitive func(cue.Path) bool) error {
+	switch err := err.(type) {
+	case *List:
+		return &List{errs: redactAll(err.errs, sensitive), omitted: err.omitted}
+	case *describedError:
+		return &describedError{desc: err.desc, err: redact(err.err, sensitive)}
+	case errors.Error:
+		if errs := errors.Errors(err); len(errs) > 1 {
+			return &List{errs: redactAll(errs, sensitive)}
+		}
+		return redactError(err, sensitive)
+	default:
+		return err
+	}
+}
+
+func redactAll(errs []errors.Error, sensitive func(cue.Path) bool) []errors.Error {
+	redacted := make([]errors.Error, len(errs))
+	for i := range errs {
+		redacted[i] = redactError(errs[i], sensitive)
+	}
+	return redacted
+}
+
+func redactError(err errors.Error, sensitive func(cue.Path) bool) errors.Error {
+	if !sensitive(toCUEPath(err.Path())) {
+		return err
+	}
+	return &redactedError{err: err}
+}
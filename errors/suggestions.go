@@ -0,0 +1,152 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package errors
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/errors"
+	"cuelang.org/go/cue/token"
+)
+
+const (
+	msgFieldNotAllowedSuggestions = "field not allowed: %s (did you mean %s?)"
+
+	maxSuggestions = 3
+)
+
+// suggestionsError extends a "field not allowed" error with the names of
+// the closest allowed fields
+type suggestionsError struct {
+	err         errors.Error
+	field       string
+	suggestions []string
+}
+
+func (e *suggestionsError) Position() token.Pos         { return e.err.Position() }
+func (e *suggestionsError) InputPositions() []token.Pos { return e.err.InputPositions() }
+func (e *suggestionsError) Path() []string              { return e.err.Path() }
+func (e *suggestionsError) Error() string               { return errors.String(e) }
+func (e *suggestionsError) Msg() (string, []interface{}) {
+	return msgFieldNotAllowedSuggestions, []interface{}{e.field, strings.Join(e.suggestions, " or ")}
+}
+
+func withSuggestions(v cue.Value, errs []errors.Error) []errors.Error {
+	// fields that are themselves not allowed must not be suggested
+	notAllowed := map[string]map[string]struct{}{}
+	for _, e := range errs {
+		if format, args := e.Msg(); format == msgFieldNotAllowed && len(args) == 1 {
+			parent := strings.Join(e.Path(), ".")
+			if notAllowed[parent] == nil {
+				notAllowed[parent] = map[string]struct{}{}
+			}
+			notAllowed[parent][fmt.Sprint(args[0])] = struct{}{}
+		}
+	}
+
+	result := make([]errors.Error, 0, len(errs))
+	for _, e := range errs {
+		format, args := e.Msg()
+		if format != msgFieldNotAllowed || len(args) != 1 {
+			result = append(result, e)
+			continue
+		}
+		name := fmt.Sprint(args[0])
+		suggestions := suggest(name, allowedFields(v, e.Path(), notAllowed[strings.Join(e.Path(), ".")]))
+		if len(suggestions) == 0 {
+			result = append(result, e)
+			continue
+		}
+		result = append(result, &suggestionsError{err: e, field: name, suggestions: suggestions})
+	}
+	return result
+}
+
+func allowedFields(v cue.Value, path []string, exclude map[string]struct{}) []string {
+	parent := v.LookupPath(toCUEPath(path))
+	if !parent.Exists() {
+		return nil
+	}
+	iter, err := parent.Fields(cue.Optional(true))
+	if err != nil {
+		return nil
+	}
+	fields := []string{}
+	for iter.Next() {
+		if _, ok := exclude[iter.Label()]; !ok {
+			fields = append(fields, iter.Label())
+		}
+	}
+	return fields
+}
+
+// suggest ranks candidates by edit distance to name, ignoring case first
+// since mismatched initialisms (e.g. subnetCidr and subnetCIDR) are the
+// most common typo, only reasonably close candidates are returned
+func suggest(name string, candidates []string) []string {
+	type candidate struct {
+		name            string
+		distance, exact int
+	}
+
+	maxDistance := len(name) / 3
+	if maxDistance < 2 {
+		maxDistance = 2
+	}
+
+	ranked := []candidate{}
+	for _, c := range candidates {
+		distance := levenshtein(strings.ToLower(name), strings.ToLower(c))
+		if distance > maxDistance {
+			continue
+		}
+		ranked = append(ranked, candidate{name: c, distance: distance, exact: levenshtein(name, c)})
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].distance != ranked[j].distance {
+			return ranked[i].distance < ranked[j].distance
+		}
+		return ranked[i].exact < ranked[j].exact
+	})
+
+	suggestions := []string{}
+	for i := 0; i < len(ranked) && i < maxSuggestions; i++ {
+		suggestions = append(suggestions, ranked[i].name)
+	}
+	return suggestions
+}
+
+func levenshtein(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	prev := make([]int, len(t)+1)
+	curr := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		curr[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(t)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
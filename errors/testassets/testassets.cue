@@ -0,0 +1,30 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package testassets
+
+#Resource: {
+	metadata: {
+		name:      string
+		namespace: string
+	}
+	spec: {
+		mode:    "Standard" | "Autopilot"
+		subnet:  =~"^10\\." @error("subnet must be within 10.0.0.0/8")
+		nodes:   int & >0
+		labels?: [string]: string
+		tier?:   "gold" | "silver" @error("tier must be either gold or silver")
+	}
+}
+
+defaults: {}
+resource: #Resource
+template: {
+	kind:       "Example"
+	apiVersion: "v1"
+	metadata: {
+		name:      resource.metadata.name
+		namespace: resource.metadata.namespace
+	}
+	spec: resource.spec
+}
@@ -0,0 +1,340 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+// Package krm runs templates as a Kubernetes Resource Model function, as used
+// in kpt and kustomize pipelines, see
+// https://github.com/kubernetes-sigs/kustomize/blob/master/cmd/config/docs/api-conventions/functions-spec.md
+package krm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+
+	"github.com/errordeveloper/cue-utils/config"
+	"github.com/errordeveloper/cue-utils/errors"
+	"github.com/errordeveloper/cue-utils/template"
+)
+
+const (
+	ResourceListAPIVersion = "config.kubernetes.io/v1"
+	ResourceListKind       = "ResourceList"
+
+	FunctionConfigAPIVersion = "cue-utils.errordeveloper.com/v1alpha1"
+	FunctionConfigKind       = "Template"
+
+	SeverityError = "error"
+)
+
+// pathAnnotations are set by orchestrators to track where items come from,
+// these are retained when an item is replaced
+var pathAnnotations = []string{
+	"config.kubernetes.io/path",
+	"config.kubernetes.io/index",
+	"internal.config.kubernetes.io/path",
+	"internal.config.kubernetes.io/index",
+	"internal.config.kubernetes.io/id",
+}
+
+// ResourceList is read from stdin and written to stdout by the function
+type ResourceList struct {
+	APIVersion     string                      `json:"apiVersion"`
+	Kind           string                      `json:"kind"`
+	Items          []unstructured.Unstructured `json:"items"`
+	FunctionConfig *unstructured.Unstructured  `json:"functionConfig,omitempty"`
+	Results        []Result                    `json:"results,omitempty"`
+}
+
+// Result reports a problem with the function config or one of the items
+type Result struct {
+	Message     string       `json:"message"`
+	Severity    string       `json:"severity,omitempty"`
+	ResourceRef *ResourceRef `json:"resourceRef,omitempty"`
+	Field       *Field       `json:"field,omitempty"`
+}
+
+type ResourceRef struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+}
+
+// Field is the path of the field that caused the result, relative to
+// the resource input of the template
+type Field struct {
+	Path         string      `json:"path"`
+	CurrentValue interface{} `json:"currentValue,omitempty"`
+}
+
+// FunctionConfig selects the template and its inputs
+type FunctionConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec FunctionConfigSpec `json:"spec"`
+}
+
+type FunctionConfigSpec struct {
+	// Template is the name of the template in config.Config
+	Template string `json:"template"`
+	// Output is the name of the output to render, the template slot is
+	// rendered by default
+	Output string `json:"output,omitempty"`
+	// Defaults are applied before the resource, if set
+	Defaults map[string]interface{} `json:"defaults,omitempty"`
+	// Resource is rendered once, if it's not set every item that matches is
+	// rendered instead
+	Resource map[string]interface{} `json:"resource,omitempty"`
+	// Match selects items by apiVersion and kind, by default the input kind
+	// declared in the template metadata is used
+	Match *metav1.TypeMeta `json:"match,omitempty"`
+}
+
+// Run reads a ResourceList from r, processes it and writes it to w; when
+// processing fails, the items are written unchanged along with the results
+// and an error is returned, so that the caller can exit with a non-zero code
+func Run(c *config.Config, r io.Reader, w io.Writer) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("unable to read resource list: %w", err)
+	}
+	list, err := Decode(data)
+	if err != nil {
+		return err
+	}
+	processErr := Process(c, list)
+	data, err = yaml.Marshal(list)
+	if err != nil {
+		return fmt.Errorf("unable to write resource list: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("unable to write resource list: %w", err)
+	}
+	return processErr
+}
+
+// Decode parses a ResourceList from YAML or JSON
+func Decode(data []byte) (*ResourceList, error) {
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse resource list: %w", err)
+	}
+	list := &ResourceList{}
+	if err := json.Unmarshal(jsonData, list); err != nil {
+		return nil, fmt.Errorf("unable to parse resource list: %w", err)
+	}
+	if list.Kind != ResourceListKind {
+		return nil, fmt.Errorf("unexpected kind %q, expected %q", list.Kind, ResourceListKind)
+	}
+	if list.Items == nil {
+		list.Items = []unstructured.Unstructured{}
+	}
+	return list, nil
+}
+
+// Process renders the template selected by the function config and adds the
+// rendered objects to the items, replacing any existing items with the same
+// kind, namespace and name, so that the function can be run repeatedly;
+// errors are added to the results and the items are left unchanged
+func Process(c *config.Config, list *ResourceList) error {
+	rendered, results := process(c, list)
+	if len(results) != 0 {
+		list.Results = append(list.Results, results...)
+		return fmt.Errorf("function failed with %d error(s)", len(results))
+	}
+	list.Items = upsert(list.Items, rendered)
+	return nil
+}
+
+func process(c *config.Config, list *ResourceList) ([]unstructured.Unstructured, []Result) {
+	fnRef := refOf(list.FunctionConfig)
+
+	fnConfig, err := decodeFunctionConfig(list.FunctionConfig)
+	if err != nil {
+		return nil, []Result{{Message: err.Error(), Severity: SeverityError, ResourceRef: fnRef}}
+	}
+	gen, err := c.Get(fnConfig.Spec.Template)
+	if err != nil {
+		return nil, []Result{{Message: err.Error(), Severity: SeverityError, ResourceRef: fnRef, Field: &Field{Path: "spec.template"}}}
+	}
+	if fnConfig.Spec.Output != "" {
+		outputs, err := gen.Outputs()
+		if err != nil {
+			return nil, []Result{{Message: err.Error(), Severity: SeverityError, ResourceRef: fnRef}}
+		}
+		if !containsString(outputs, fnConfig.Spec.Output) {
+			return nil, []Result{{Message: fmt.Sprintf("unknown output %q (outputs: %v)", fnConfig.Spec.Output, outputs), Severity: SeverityError, ResourceRef: fnRef, Field: &Field{Path: "spec.output"}}}
+		}
+	}
+	slots := gen.Slots()
+	if fnConfig.Spec.Defaults != nil {
+		withDefaults, err := gen.WithDefaults(fnConfig.Spec.Defaults)
+		if err != nil {
+			return nil, resultsOf(err, fnRef, slots.Defaults, "spec.defaults")
+		}
+		gen = withDefaults
+	}
+
+	if fnConfig.Spec.Resource != nil {
+		objs, err := render(gen, fnConfig.Spec.Resource, fnConfig.Spec.Output)
+		if err != nil {
+			return nil, resultsOf(err, fnRef, slots.Resource, "spec.resource")
+		}
+		return objs, nil
+	}
+
+	match := gen.Metadata().InputKind
+	if fnConfig.Spec.Match != nil {
+		match = *fnConfig.Spec.Match
+	}
+	if match.Kind == "" {
+		return nil, []Result{{Message: fmt.Sprintf("template %q doesn't declare an input kind, either spec.resource or spec.match must be set", fnConfig.Spec.Template), Severity: SeverityError, ResourceRef: fnRef}}
+	}
+
+	rendered := []unstructured.Unstructured{}
+	results := []Result{}
+	for i := range list.Items {
+		item := &list.Items[i]
+		if item.GetKind() != match.Kind || (match.APIVersion != "" && item.GetAPIVersion() != match.APIVersion) {
+			continue
+		}
+		objs, err := render(gen, item.Object, fnConfig.Spec.Output)
+		if err != nil {
+			results = append(results, resultsOf(err, refOf(item), slots.Resource, "")...)
+			continue
+		}
+		rendered = append(rendered, objs...)
+	}
+	return rendered, results
+}
+
+func decodeFunctionConfig(obj *unstructured.Unstructured) (*FunctionConfig, error) {
+	if obj == nil {
+		return nil, fmt.Errorf("functionConfig must be set")
+	}
+	if obj.GetAPIVersion() != FunctionConfigAPIVersion || obj.GetKind() != FunctionConfigKind {
+		return nil, fmt.Errorf("unsupported functionConfig %s/%s, expected %s/%s", obj.GetAPIVersion(), obj.GetKind(), FunctionConfigAPIVersion, FunctionConfigKind)
+	}
+	fnConfig := &FunctionConfig{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, fnConfig); err != nil {
+		return nil, fmt.Errorf("invalid functionConfig: %w", err)
+	}
+	if fnConfig.Spec.Template == "" {
+		return nil, fmt.Errorf("invalid functionConfig: spec.template must be set")
+	}
+	return fnConfig, nil
+}
+
+func render(gen *template.Generator, resource map[string]interface{}, output string) ([]unstructured.Unstructured, error) {
+	gen, err := gen.WithResource(resource)
+	if err != nil {
+		return nil, err
+	}
+	if output != "" {
+		return gen.RenderObjectsFor(output)
+	}
+	return gen.RenderObjects()
+}
+
+// resultsOf converts CUE errors to results, with field paths relative to the
+// given slot; the prefix is the path of the input within the referenced
+// resource, e.g. spec.resource for inputs given in the function config;
+// errors outside of the slot (e.g. when rendering fails) don't refer to
+// any field of the resource, so these are reported without one
+func resultsOf(err error, ref *ResourceRef, slot, prefix string) []Result {
+	inSlot := func(path []string) bool { return len(path) != 0 && path[0] == slot }
+	results := []Result{}
+	for _, fieldErr := range errors.FieldErrorList(errors.Filter(err, inSlot), slot) {
+		path := fieldErr.Field
+		switch {
+		case prefix == "":
+		case path == slot:
+			path = prefix
+		default:
+			path = prefix + "." + path
+		}
+		results = append(results, Result{
+			Message:     fieldErr.ErrorBody(),
+			Severity:    SeverityError,
+			ResourceRef: ref,
+			Field:       &Field{Path: path, CurrentValue: fieldErr.BadValue},
+		})
+	}
+	outsideSlot := func(path []string) bool { return !inSlot(path) }
+	for _, fieldErr := range errors.FieldErrorList(errors.Filter(err, outsideSlot), slot) {
+		message := fieldErr.Error()
+		if fieldErr.Type == field.ErrorTypeInternal {
+			message = fieldErr.Detail
+		}
+		results = append(results, Result{
+			Message:     message,
+			Severity:    SeverityError,
+			ResourceRef: ref,
+		})
+	}
+	return results
+}
+
+func refOf(obj *unstructured.Unstructured) *ResourceRef {
+	if obj == nil {
+		return nil
+	}
+	return &ResourceRef{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Name:       obj.GetName(),
+		Namespace:  obj.GetNamespace(),
+	}
+}
+
+func upsert(items, objs []unstructured.Unstructured) []unstructured.Unstructured {
+	index := map[string]int{}
+	for i := range items {
+		index[keyOf(&items[i])] = i
+	}
+	for i := range objs {
+		if j, ok := index[keyOf(&objs[i])]; ok {
+			retainPathAnnotations(&items[j], &objs[i])
+			items[j] = objs[i]
+			continue
+		}
+		index[keyOf(&objs[i])] = len(items)
+		items = append(items, objs[i])
+	}
+	return items
+}
+
+func keyOf(obj *unstructured.Unstructured) string {
+	return fmt.Sprintf("%s/%s/%s", obj.GroupVersionKind().GroupKind(), obj.GetNamespace(), obj.GetName())
+}
+
+func retainPathAnnotations(from, to *unstructured.Unstructured) {
+	annotations := to.GetAnnotations()
+	for _, key := range pathAnnotations {
+		if value, ok := from.GetAnnotations()[key]; ok {
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[key] = value
+		}
+	}
+	if annotations != nil {
+		to.SetAnnotations(annotations)
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
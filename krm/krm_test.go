@@ -0,0 +1,428 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package krm_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/errordeveloper/cue-utils/config"
+	. "github.com/errordeveloper/cue-utils/krm"
+)
+
+const clusterTemplate = "github.com/errordeveloper/cue-utils/krm/testassets/cluster"
+
+func TestRun(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	c := &config.Config{BaseDirectory: "./testassets"}
+	g.Expect(c.Load()).To(Succeed())
+
+	run := func(input string) (string, error) {
+		out := &bytes.Buffer{}
+		err := Run(c, strings.NewReader(input), out)
+		return out.String(), err
+	}
+
+	{
+		out, err := run(`
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: example.com/v1
+  kind: Cluster
+  metadata:
+    name: foo
+    annotations:
+      config.kubernetes.io/local-config: "true"
+      internal.config.kubernetes.io/path: clusters.yaml
+  spec:
+    location: us-central1
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: foo-location
+    namespace: default
+    annotations:
+      internal.config.kubernetes.io/path: generated.yaml
+  data:
+    location: europe-west1
+- apiVersion: example.com/v1
+  kind: Cluster
+  metadata:
+    name: bar
+    namespace: other
+  spec:
+    location: europe-west1
+functionConfig:
+  apiVersion: cue-utils.errordeveloper.com/v1alpha1
+  kind: Template
+  metadata:
+    name: clusters
+  spec:
+    template: ` + clusterTemplate + `
+`)
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(out).To(Equal(`apiVersion: config.kubernetes.io/v1
+functionConfig:
+  apiVersion: cue-utils.errordeveloper.com/v1alpha1
+  kind: Template
+  metadata:
+    name: clusters
+  spec:
+    template: github.com/errordeveloper/cue-utils/krm/testassets/cluster
+items:
+- apiVersion: example.com/v1
+  kind: Cluster
+  metadata:
+    annotations:
+      config.kubernetes.io/local-config: "true"
+      internal.config.kubernetes.io/path: clusters.yaml
+    name: foo
+  spec:
+    location: us-central1
+- apiVersion: v1
+  data:
+    location: us-central1
+  kind: ConfigMap
+  metadata:
+    annotations:
+      internal.config.kubernetes.io/path: generated.yaml
+    name: foo-location
+    namespace: default
+- apiVersion: example.com/v1
+  kind: Cluster
+  metadata:
+    name: bar
+    namespace: other
+  spec:
+    location: europe-west1
+- apiVersion: v1
+  data:
+    location: europe-west1
+  kind: ConfigMap
+  metadata:
+    name: bar-location
+    namespace: other
+kind: ResourceList
+`))
+	}
+
+	{
+		out, err := run(`
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items: []
+functionConfig:
+  apiVersion: cue-utils.errordeveloper.com/v1alpha1
+  kind: Template
+  metadata:
+    name: cluster
+  spec:
+    template: ` + clusterTemplate + `
+    resource:
+      apiVersion: example.com/v1
+      kind: Cluster
+      metadata:
+        name: baz
+      spec:
+        location: europe-west1
+`)
+		g.Expect(err).To(Not(HaveOccurred()))
+		list, err := Decode([]byte(out))
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(list.Results).To(BeEmpty())
+		g.Expect(list.Items).To(HaveLen(1))
+		g.Expect(list.Items[0].GetName()).To(Equal("baz-location"))
+		g.Expect(list.Items[0].Object["data"]).To(Equal(map[string]interface{}{"location": "europe-west1"}))
+	}
+
+	{
+		input := `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: example.com/v1
+  kind: Cluster
+  metadata:
+    name: foo
+  spec:
+    location: us-central1
+- apiVersion: example.com/v1
+  kind: Cluster
+  metadata:
+    name: bar
+  spec:
+    location: asia-east1
+functionConfig:
+  apiVersion: cue-utils.errordeveloper.com/v1alpha1
+  kind: Template
+  metadata:
+    name: clusters
+  spec:
+    template: ` + clusterTemplate + `
+`
+		out, err := run(input)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Equal("function failed with 1 error(s)"))
+		g.Expect(out).To(Equal(`apiVersion: config.kubernetes.io/v1
+functionConfig:
+  apiVersion: cue-utils.errordeveloper.com/v1alpha1
+  kind: Template
+  metadata:
+    name: clusters
+  spec:
+    template: github.com/errordeveloper/cue-utils/krm/testassets/cluster
+items:
+- apiVersion: example.com/v1
+  kind: Cluster
+  metadata:
+    name: foo
+  spec:
+    location: us-central1
+- apiVersion: example.com/v1
+  kind: Cluster
+  metadata:
+    name: bar
+  spec:
+    location: asia-east1
+kind: ResourceList
+results:
+- field:
+    currentValue: asia-east1
+    path: spec.location
+  message: 'Unsupported value: "asia-east1": supported values: "us-central1", "europe-west1"'
+  resourceRef:
+    apiVersion: example.com/v1
+    kind: Cluster
+    name: bar
+  severity: error
+`))
+	}
+
+	{
+		out, err := run(`
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items: []
+functionConfig:
+  apiVersion: cue-utils.errordeveloper.com/v1alpha1
+  kind: Template
+  metadata:
+    name: cluster
+  spec:
+    template: ` + clusterTemplate + `
+    defaults:
+      location: europe-west1
+    resource:
+      apiVersion: example.com/v1
+      kind: Cluster
+      metadata:
+        name: baz
+`)
+		g.Expect(err).To(Not(HaveOccurred()))
+		list, err := Decode([]byte(out))
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(list.Items).To(HaveLen(1))
+		g.Expect(list.Items[0].Object["data"]).To(Equal(map[string]interface{}{"location": "europe-west1"}))
+	}
+
+	{
+		out, err := run(`
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items: []
+functionConfig:
+  apiVersion: cue-utils.errordeveloper.com/v1alpha1
+  kind: Template
+  metadata:
+    name: cluster
+  spec:
+    template: ` + clusterTemplate + `
+    defaults:
+      location: asia-east1
+    resource:
+      apiVersion: example.com/v1
+      kind: Cluster
+      metadata:
+        name: baz
+`)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Equal("function failed with 1 error(s)"))
+		g.Expect(out).To(Equal(`apiVersion: config.kubernetes.io/v1
+functionConfig:
+  apiVersion: cue-utils.errordeveloper.com/v1alpha1
+  kind: Template
+  metadata:
+    name: cluster
+  spec:
+    defaults:
+      location: asia-east1
+    resource:
+      apiVersion: example.com/v1
+      kind: Cluster
+      metadata:
+        name: baz
+    template: github.com/errordeveloper/cue-utils/krm/testassets/cluster
+items: []
+kind: ResourceList
+results:
+- field:
+    currentValue: asia-east1
+    path: spec.defaults.location
+  message: 'Unsupported value: "asia-east1": supported values: "us-central1", "europe-west1"'
+  resourceRef:
+    apiVersion: cue-utils.errordeveloper.com/v1alpha1
+    kind: Template
+    name: cluster
+  severity: error
+`))
+	}
+
+	{
+		out, err := run(`
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items: []
+functionConfig:
+  apiVersion: cue-utils.errordeveloper.com/v1alpha1
+  kind: Template
+  metadata:
+    name: cluster
+  spec:
+    template: ` + clusterTemplate + `
+    resource:
+      apiVersion: example.com/v1
+      kind: Cluster
+      metadata:
+        name: baz
+      spec:
+        location: asia-east1
+`)
+		g.Expect(err).To(HaveOccurred())
+		list, err := Decode([]byte(out))
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(list.Items).To(BeEmpty())
+		g.Expect(list.Results).To(HaveLen(1))
+		g.Expect(list.Results[0].ResourceRef).To(Equal(&ResourceRef{APIVersion: FunctionConfigAPIVersion, Kind: FunctionConfigKind, Name: "cluster"}))
+		g.Expect(list.Results[0].Field).To(Equal(&Field{Path: "spec.resource.spec.location", CurrentValue: "asia-east1"}))
+	}
+
+	{
+		out, err := run(`
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items: []
+functionConfig:
+  apiVersion: cue-utils.errordeveloper.com/v1alpha1
+  kind: Template
+  metadata:
+    name: cluster
+  spec:
+    template: ` + clusterTemplate + `
+    output: dashboards
+    resource:
+      apiVersion: example.com/v1
+      kind: Cluster
+      metadata:
+        name: baz
+      spec:
+        location: us-central1
+`)
+		g.Expect(err).To(HaveOccurred())
+		list, err := Decode([]byte(out))
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(list.Items).To(BeEmpty())
+		g.Expect(list.Results).To(HaveLen(1))
+		g.Expect(list.Results[0].Message).To(Equal(`unknown output "dashboards" (outputs: [template])`))
+		g.Expect(list.Results[0].Field).To(Equal(&Field{Path: "spec.output"}))
+	}
+
+	{
+		// rendering fails outside of the resource, so the result doesn't
+		// refer to a field of the function config
+		out, err := run(`
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items: []
+functionConfig:
+  apiVersion: cue-utils.errordeveloper.com/v1alpha1
+  kind: Template
+  metadata:
+    name: cluster
+  spec:
+    template: ` + clusterTemplate + `
+    resource:
+      apiVersion: example.com/v1
+      kind: Cluster
+      spec:
+        location: us-central1
+`)
+		g.Expect(err).To(HaveOccurred())
+		list, err := Decode([]byte(out))
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(list.Items).To(BeEmpty())
+		g.Expect(list.Results).To(Equal([]Result{{
+			Message:     "template.metadata.name: Required value",
+			Severity:    SeverityError,
+			ResourceRef: &ResourceRef{APIVersion: FunctionConfigAPIVersion, Kind: FunctionConfigKind, Name: "cluster"},
+		}}))
+	}
+
+	{
+		out, err := run(`
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items: []
+functionConfig:
+  apiVersion: cue-utils.errordeveloper.com/v1alpha1
+  kind: Template
+  metadata:
+    name: unknown
+  spec:
+    template: example.com/unknown
+`)
+		g.Expect(err).To(HaveOccurred())
+		list, err := Decode([]byte(out))
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(list.Results).To(Equal([]Result{{
+			Message:     `unknown template "example.com/unknown"`,
+			Severity:    SeverityError,
+			ResourceRef: &ResourceRef{APIVersion: FunctionConfigAPIVersion, Kind: FunctionConfigKind, Name: "unknown"},
+			Field:       &Field{Path: "spec.template"},
+		}}))
+	}
+
+	{
+		out, err := run(`
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items: []
+functionConfig:
+  apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: config
+`)
+		g.Expect(err).To(HaveOccurred())
+		list, err := Decode([]byte(out))
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(list.Results).To(HaveLen(1))
+		g.Expect(list.Results[0].Message).To(Equal("unsupported functionConfig v1/ConfigMap, expected cue-utils.errordeveloper.com/v1alpha1/Template"))
+	}
+
+	{
+		out, err := run(`
+apiVersion: v1
+kind: List
+items: []
+`)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Equal(`unexpected kind "List", expected "ResourceList"`))
+		g.Expect(out).To(BeEmpty())
+	}
+}
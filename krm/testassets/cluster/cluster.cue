@@ -0,0 +1,32 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package cluster
+
+#meta: inputKind: {
+	apiVersion: "example.com/v1"
+	kind:       "Cluster"
+}
+
+defaults: location: *"us-central1" | "europe-west1"
+
+resource: {
+	apiVersion: "example.com/v1"
+	kind:       "Cluster"
+	metadata: {
+		name:      string
+		namespace: string | *"default"
+		...
+	}
+	spec: location: *defaults.location | "us-central1" | "europe-west1"
+}
+
+template: {
+	kind:       "ConfigMap"
+	apiVersion: "v1"
+	metadata: {
+		namespace: resource.metadata.namespace
+		name:      "\(resource.metadata.name)-location"
+	}
+	data: location: resource.spec.location
+}
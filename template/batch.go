@@ -0,0 +1,89 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package template
+
+import (
+	"context"
+	goruntime "runtime"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// BatchResult holds either the objects rendered for one item of a batch
+// or the error that occurred
+type BatchResult struct {
+	Objects []unstructured.Unstructured
+	Err     error
+}
+
+// WithBatchWorkers sets the number of workers used by RenderBatch, by default
+// GOMAXPROCS is used
+func WithBatchWorkers(n int) Option {
+	return func(g *Generator) {
+		g.batchWorkers = n
+	}
+}
+
+// RenderBatch fills each of the given resources and renders objects for it,
+// using a pool of workers; results are returned in the same order as inputs;
+// when ctx is cancelled, items that haven't been rendered yet fail with the
+// context error, which is also returned; note that all CUE operations hold
+// the shared compiler lock, so only parsing and transforming of rendered
+// objects happens concurrently
+func (g *Generator) RenderBatch(ctx context.Context, inputs []interface{}) ([]BatchResult, error) {
+	results := make([]BatchResult, len(inputs))
+
+	workers := g.batchWorkers
+	if workers <= 0 {
+		workers = goruntime.GOMAXPROCS(0)
+	}
+	if workers > len(inputs) {
+		workers = len(inputs)
+	}
+
+	items := make(chan int)
+	wg := &sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range items {
+				results[i] = g.renderItem(ctx, inputs[i])
+			}
+		}()
+	}
+
+	var err error
+	for i := range inputs {
+		if err == nil {
+			select {
+			case items <- i:
+				continue
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+		}
+		results[i] = BatchResult{Err: err}
+	}
+	close(items)
+	wg.Wait()
+
+	return results, err
+}
+
+func (g *Generator) renderItem(ctx context.Context, input interface{}) BatchResult {
+	if err := ctx.Err(); err != nil {
+		return BatchResult{Err: err}
+	}
+	gen, err := g.WithResource(input)
+	if err != nil {
+		return BatchResult{Err: err}
+	}
+	objs, err := gen.RenderObjects()
+	if err != nil {
+		return BatchResult{Err: err}
+	}
+	return BatchResult{Objects: objs}
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package template
+
+import (
+	"fmt"
+
+	"cuelang.org/go/cue"
+
+	"github.com/errordeveloper/cue-utils/errors"
+)
+
+// IncompleteField is a field of an output that is not concrete, which
+// would prevent it from being rendered
+type IncompleteField struct {
+	// Path of the field, e.g. template.items[0].metadata.namespace
+	Path string
+	// Value is the current value of the field, e.g. string
+	Value string
+	// DependsOn lists the inputs that need to be supplied for the field to
+	// become concrete, e.g. resource.metadata.namespace
+	DependsOn []string
+}
+
+// Check lists every field that is not concrete across all outputs, so all
+// missing inputs can be reported together, instead of rendering failing on
+// the first one
+func (g *Generator) Check() ([]IncompleteField, error) {
+	g.cue.LockMutex()
+	defer g.cue.UnlockMutex()
+
+	outputs, err := g.outputs()
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []IncompleteField{}
+	for _, name := range outputs {
+		val := g.Value.LookupPath(cue.ParsePath(g.outputPath(name)))
+		if !val.Exists() {
+			return nil, fmt.Errorf("unable to lookup path %q: %w", g.outputPath(name), val.Err())
+		}
+		g.checkValue(val, &fields)
+	}
+	return fields, nil
+}
+
+func (g *Generator) checkValue(v cue.Value, fields *[]IncompleteField) {
+	switch v.IncompleteKind() {
+	case cue.StructKind:
+		if iter, err := v.Fields(); err == nil {
+			for iter.Next() {
+				g.checkValue(iter.Value(), fields)
+			}
+			return
+		}
+	case cue.ListKind:
+		if iter, err := v.List(); err == nil {
+			for iter.Next() {
+				g.checkValue(iter.Value(), fields)
+			}
+			return
+		}
+	}
+
+	if v.Validate(cue.Concrete(true)) == nil {
+		return
+	}
+	dependsOn := []string{}
+	g.dependencies(v, map[string]struct{}{}, &dependsOn)
+	value := fmt.Sprint(v)
+	if g.sensitive && g.isSensitiveLeaf(v) {
+		value = errors.Redacted
+	}
+	*fields = append(*fields, IncompleteField{
+		Path:      v.Path().String(),
+		Value:     value,
+		DependsOn: dependsOn,
+	})
+}
+
+// dependencies finds references to inputs that are not concrete yet, any
+// other references (e.g. to intermediate variables) are followed
+func (g *Generator) dependencies(v cue.Value, visited map[string]struct{}, dependsOn *[]string) {
+	if root, path := v.ReferencePath(); len(path.Selectors()) != 0 {
+		ref := path.String()
+		if _, ok := visited[ref]; ok {
+			return
+		}
+		visited[ref] = struct{}{}
+
+		target := root.LookupPath(path)
+		if target.Validate(cue.Concrete(true)) == nil {
+			return
+		}
+		if g.checkInput(ref) == nil {
+			*dependsOn = append(*dependsOn, ref)
+			return
+		}
+		g.dependencies(target, visited, dependsOn)
+		return
+	}
+
+	op, args := v.Expr()
+	if op == cue.NoOp && len(args) == 1 {
+		return
+	}
+	for _, arg := range args {
+		g.dependencies(arg, visited, dependsOn)
+	}
+}
@@ -0,0 +1,319 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package template
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// maxSchemaDepth limits nesting of generated schemas, as recursive
+// definitions cannot be expressed in a structural schema
+const maxSchemaDepth = 32
+
+// CRDOptions describe the custom resource that a CRD is generated for,
+// Plural defaults to lower-case kind with "s" appended and Scope defaults
+// to "Namespaced"
+type CRDOptions struct {
+	Group   string
+	Version string
+	Kind    string
+	Plural  string
+	Scope   string
+}
+
+// GenerateCRD returns a CustomResourceDefinition with a structural schema
+// derived from the resource definition of the template; defaults, enums,
+// patterns, bounds, optional fields and doc comments are included in the
+// schema; metadata is left to the API server to validate, and when the
+// resource has a status field the status subresource is enabled
+func (g *Generator) GenerateCRD(options CRDOptions) (*unstructured.Unstructured, error) {
+	if options.Group == "" || options.Version == "" || options.Kind == "" {
+		return nil, fmt.Errorf("group, version and kind must be set")
+	}
+	if options.Plural == "" {
+		options.Plural = strings.ToLower(options.Kind) + "s"
+	}
+	switch options.Scope {
+	case "":
+		options.Scope = "Namespaced"
+	case "Namespaced", "Cluster":
+	default:
+		return nil, fmt.Errorf("invalid scope %q, must be either Namespaced or Cluster", options.Scope)
+	}
+
+	g.cue.LockMutex()
+	defer g.cue.UnlockMutex()
+
+	resource := g.Value.LookupPath(cue.ParsePath(g.slots.Resource))
+	if !resource.Exists() {
+		return nil, fmt.Errorf("resource %q is not defined", g.slots.Resource)
+	}
+	if resource.IncompleteKind() != cue.StructKind {
+		return nil, fmt.Errorf("resource %q must be a struct, not %s", g.slots.Resource, resource.IncompleteKind())
+	}
+
+	schema, err := structSchema(resource, 0, map[string]struct{}{
+		"apiVersion": {},
+		"kind":       {},
+		"metadata":   {},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate schema for %q: %w", g.slots.Resource, err)
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+	if properties == nil {
+		properties = map[string]interface{}{}
+		schema["properties"] = properties
+	}
+	properties["apiVersion"] = map[string]interface{}{"type": "string"}
+	properties["kind"] = map[string]interface{}{"type": "string"}
+	properties["metadata"] = map[string]interface{}{"type": "object"}
+
+	version := map[string]interface{}{
+		"name":    options.Version,
+		"served":  true,
+		"storage": true,
+		"schema":  map[string]interface{}{"openAPIV3Schema": schema},
+	}
+	if _, ok := properties["status"]; ok {
+		version["subresources"] = map[string]interface{}{"status": map[string]interface{}{}}
+	}
+
+	crd := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"group": options.Group,
+			"names": map[string]interface{}{
+				"kind":     options.Kind,
+				"listKind": options.Kind + "List",
+				"plural":   options.Plural,
+				"singular": strings.ToLower(options.Kind),
+			},
+			"scope":    options.Scope,
+			"versions": []interface{}{version},
+		},
+	}}
+	crd.SetAPIVersion("apiextensions.k8s.io/v1")
+	crd.SetKind("CustomResourceDefinition")
+	crd.SetName(options.Plural + "." + options.Group)
+	return crd, nil
+}
+
+func schemaOf(v cue.Value, depth int) (map[string]interface{}, error) {
+	if depth > maxSchemaDepth {
+		return nil, fmt.Errorf("%s: schema is nested too deeply, recursive definitions are not supported", v.Path())
+	}
+
+	schema := map[string]interface{}{}
+	if doc := docString(v); doc != "" {
+		schema["description"] = doc
+	}
+
+	kind := v.IncompleteKind()
+	if kind&cue.NullKind != 0 && kind != cue.NullKind {
+		schema["nullable"] = true
+		kind &^= cue.NullKind
+	}
+
+	switch kind {
+	case cue.StructKind:
+		s, err := structSchema(v, depth, nil)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range s {
+			schema[k] = v
+		}
+		return schema, nil
+	case cue.ListKind:
+		schema["type"] = "array"
+		elem := v.LookupPath(cue.MakePath(cue.AnyIndex))
+		if !elem.Exists() {
+			schema["items"] = map[string]interface{}{"x-kubernetes-preserve-unknown-fields": true}
+			break
+		}
+		items, err := schemaOf(elem, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		schema["items"] = items
+	case cue.StringKind, cue.IntKind, cue.FloatKind, cue.NumberKind, cue.BoolKind:
+		schema["type"] = scalarType(kind)
+		constraints(v, schema)
+	case cue.IntKind | cue.StringKind:
+		schema["x-kubernetes-int-or-string"] = true
+	default:
+		schema["x-kubernetes-preserve-unknown-fields"] = true
+	}
+
+	if def, ok := v.Default(); ok && def.IsConcrete() && kind&(cue.StructKind|cue.ListKind) == 0 {
+		value, err := scalarValue(def)
+		if err != nil {
+			return nil, err
+		}
+		schema["default"] = value
+	}
+	return schema, nil
+}
+
+func structSchema(v cue.Value, depth int, skip map[string]struct{}) (map[string]interface{}, error) {
+	schema := map[string]interface{}{"type": "object"}
+
+	iter, err := v.Fields(cue.Optional(true))
+	if err != nil {
+		return nil, err
+	}
+	properties := map[string]interface{}{}
+	required := []interface{}{}
+	for iter.Next() {
+		label := iter.Label()
+		if _, ok := skip[label]; ok {
+			continue
+		}
+		field, err := schemaOf(iter.Value(), depth+1)
+		if err != nil {
+			return nil, err
+		}
+		properties[label] = field
+		if !iter.IsOptional() {
+			required = append(required, label)
+		}
+	}
+	if len(properties) != 0 {
+		schema["properties"] = properties
+	}
+	if len(required) != 0 {
+		schema["required"] = required
+	}
+
+	// pattern constraints and open structs, which allow any field
+	if elem := v.LookupPath(cue.MakePath(cue.AnyString)); elem.Exists() {
+		switch {
+		case elem.IncompleteKind() == cue.TopKind:
+			schema["x-kubernetes-preserve-unknown-fields"] = true
+		case len(properties) == 0:
+			additionalProperties, err := schemaOf(elem, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			schema["additionalProperties"] = additionalProperties
+		}
+	}
+	return schema, nil
+}
+
+// constraints adds enums, patterns and bounds of a scalar value to the schema
+func constraints(v cue.Value, schema map[string]interface{}) {
+	op, args := v.Expr()
+	switch op {
+	case cue.NoOp:
+		if len(args) == 1 {
+			if argOp, _ := args[0].Expr(); argOp != cue.NoOp {
+				constraints(args[0], schema)
+			}
+		}
+	case cue.AndOp:
+		for _, arg := range args {
+			constraints(arg, schema)
+		}
+	case cue.OrOp:
+		enum := []interface{}{}
+		for _, arg := range args {
+			if arg.IncompleteKind() == cue.NullKind {
+				continue
+			}
+			if !arg.IsConcrete() {
+				return
+			}
+			value, err := scalarValue(arg)
+			if err != nil {
+				return
+			}
+			enum = append(enum, value)
+		}
+		if len(enum) != 0 {
+			schema["enum"] = enum
+		}
+	case cue.RegexMatchOp:
+		if pattern, err := args[0].String(); err == nil {
+			schema["pattern"] = pattern
+		}
+	case cue.GreaterThanOp, cue.GreaterThanEqualOp:
+		if bound, ok := numberValue(args[0]); ok {
+			if min, ok := schema["minimum"].(float64); !ok || bound > min || (bound == min && op == cue.GreaterThanOp) {
+				schema["minimum"] = bound
+				schema["exclusiveMinimum"] = op == cue.GreaterThanOp
+			}
+		}
+	case cue.LessThanOp, cue.LessThanEqualOp:
+		if bound, ok := numberValue(args[0]); ok {
+			if max, ok := schema["maximum"].(float64); !ok || bound < max || (bound == max && op == cue.LessThanOp) {
+				schema["maximum"] = bound
+				schema["exclusiveMaximum"] = op == cue.LessThanOp
+			}
+		}
+	}
+	if exclusive, ok := schema["exclusiveMinimum"].(bool); ok && !exclusive {
+		delete(schema, "exclusiveMinimum")
+	}
+	if exclusive, ok := schema["exclusiveMaximum"].(bool); ok && !exclusive {
+		delete(schema, "exclusiveMaximum")
+	}
+}
+
+// numberValue returns the value of a number, Float64 is not used as
+// it reports an error for some exact values, e.g. zero
+func numberValue(v cue.Value) (float64, bool) {
+	data, err := v.MarshalJSON()
+	if err != nil {
+		return 0, false
+	}
+	bound, err := strconv.ParseFloat(string(data), 64)
+	return bound, err == nil
+}
+
+func scalarType(kind cue.Kind) string {
+	switch kind {
+	case cue.StringKind:
+		return "string"
+	case cue.IntKind:
+		return "integer"
+	case cue.BoolKind:
+		return "boolean"
+	default:
+		return "number"
+	}
+}
+
+func scalarValue(v cue.Value) (interface{}, error) {
+	switch v.Kind() {
+	case cue.StringKind:
+		return v.String()
+	case cue.IntKind:
+		return v.Int64()
+	case cue.FloatKind, cue.NumberKind:
+		if value, ok := numberValue(v); ok {
+			return value, nil
+		}
+		return v.Float64()
+	case cue.BoolKind:
+		return v.Bool()
+	default:
+		var value interface{}
+		err := v.Decode(&value)
+		return value, err
+	}
+}
+
+func docString(v cue.Value) string {
+	docs := []string{}
+	for _, doc := range v.Doc() {
+		docs = append(docs, strings.TrimSpace(doc.Text()))
+	}
+	return strings.Join(docs, "\n")
+}
@@ -0,0 +1,210 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package template
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultNaming is the file naming scheme used by RenderToDirectory
+const DefaultNaming = "<namespace>/<kind>-<name>.yaml"
+
+// DirectoryOptions control how RenderToDirectory names and tracks files
+type DirectoryOptions struct {
+	// Naming is the path of each file relative to the directory, it may use
+	// <namespace>, <kind>, <name>, <group> and <version> placeholders, kind
+	// is converted to lower case and cluster-scoped objects have an empty
+	// namespace; DefaultNaming is used when unset
+	Naming string
+	// Owner is recorded in the header of each file, only files with the same
+	// owner are updated or pruned; defaults to the import path of the template
+	Owner string
+}
+
+// DirectoryResult lists paths of files relative to the directory
+type DirectoryResult struct {
+	Added     []string
+	Changed   []string
+	Removed   []string
+	Unchanged []string
+}
+
+// RenderToDirectory writes each rendered object as YAML to its own file
+// within dir and removes files it had written previously, which are no
+// longer rendered; files not owned by the generator are never modified
+func (g *Generator) RenderToDirectory(dir string, options DirectoryOptions) (*DirectoryResult, error) {
+	if options.Naming == "" {
+		options.Naming = DefaultNaming
+	}
+	if options.Owner == "" {
+		options.Owner = g.ImportPath
+	}
+	header := []byte(fmt.Sprintf("# Code generated by cue-utils from %s; DO NOT EDIT.\n", options.Owner))
+
+	objs, err := g.RenderObjects()
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{}
+	for i := range objs {
+		path, err := objectPath(options.Naming, &objs[i])
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := files[path]; ok {
+			return nil, fmt.Errorf("more than one object would be written to %q", path)
+		}
+		data, err := yaml.Marshal(objs[i].Object)
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode object %q as YAML: %w", objs[i].GetName(), err)
+		}
+		files[path] = append(append([]byte{}, header...), data...)
+	}
+
+	result := &DirectoryResult{}
+
+	// check every file before writing any, so that nothing is left half-done
+	// when a file is not owned by the generator
+	write := []string{}
+	for path, data := range files {
+		fullPath := filepath.Join(dir, path)
+		existing, err := os.ReadFile(fullPath)
+		switch {
+		case os.IsNotExist(err):
+			result.Added = append(result.Added, path)
+		case err != nil:
+			return nil, fmt.Errorf("unable to read %q: %w", fullPath, err)
+		case !bytes.HasPrefix(existing, header):
+			return nil, fmt.Errorf("refusing to overwrite %q, as it is not owned by %s", fullPath, options.Owner)
+		case bytes.Equal(existing, data):
+			result.Unchanged = append(result.Unchanged, path)
+			continue
+		default:
+			result.Changed = append(result.Changed, path)
+		}
+		write = append(write, path)
+	}
+
+	for _, path := range write {
+		fullPath := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+			return nil, fmt.Errorf("unable to create directory for %q: %w", fullPath, err)
+		}
+		if err := os.WriteFile(fullPath, files[path], 0o644); err != nil {
+			return nil, fmt.Errorf("unable to write %q: %w", fullPath, err)
+		}
+	}
+
+	removed, err := prune(dir, header, files)
+	if err != nil {
+		return nil, err
+	}
+	result.Removed = removed
+
+	sort.Strings(result.Added)
+	sort.Strings(result.Changed)
+	sort.Strings(result.Unchanged)
+	return result, nil
+}
+
+func objectPath(naming string, obj *unstructured.Unstructured) (string, error) {
+	gvk := obj.GroupVersionKind()
+	path := strings.NewReplacer(
+		"<namespace>", obj.GetNamespace(),
+		"<kind>", strings.ToLower(gvk.Kind),
+		"<name>", obj.GetName(),
+		"<group>", gvk.Group,
+		"<version>", gvk.Version,
+	).Replace(naming)
+
+	path = strings.TrimPrefix(filepath.Clean("/"+path), "/")
+	if path == "" || strings.HasSuffix(naming, "/") {
+		return "", fmt.Errorf("invalid path for object %q (naming: %q)", obj.GetName(), naming)
+	}
+	return path, nil
+}
+
+// prune removes files with the given header that are not in keep, as well
+// as any directories that become empty as a result
+func prune(dir string, header []byte, keep map[string][]byte) ([]string, error) {
+	dir = filepath.Clean(dir)
+	removed := []string{}
+	dirs := map[string]struct{}{}
+
+	err := filepath.WalkDir(dir, func(fullPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && fullPath == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() || !entry.Type().IsRegular() {
+			return nil
+		}
+		path, err := filepath.Rel(dir, fullPath)
+		if err != nil {
+			return err
+		}
+		if _, ok := keep[path]; ok {
+			return nil
+		}
+		owned, err := hasHeader(fullPath, header)
+		if err != nil || !owned {
+			return err
+		}
+		if err := os.Remove(fullPath); err != nil {
+			return err
+		}
+		removed = append(removed, path)
+		dirs[filepath.Dir(fullPath)] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to prune files in %q: %w", dir, err)
+	}
+
+	for d := range dirs {
+		for within(dir, d) {
+			// only empty directories can be removed, so any errors are ignored
+			if os.Remove(d) != nil {
+				break
+			}
+			d = filepath.Dir(d)
+		}
+	}
+
+	sort.Strings(removed)
+	return removed, nil
+}
+
+// within reports whether path is inside dir, but not dir itself
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func hasHeader(path string, header []byte) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return false, nil
+	}
+	return bytes.Equal(line, header), nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package template
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ContentHashSuffix returns a transformer that appends a hash of contents
+// to names of ConfigMaps and Secrets, like kustomize does, and rewrites
+// references to these in pod specs of other objects in the same namespace,
+// so that pods are rolled out whenever contents change; it should run after
+// any transformers that change names or namespaces
+func ContentHashSuffix() Transformer {
+	return TransformerFunc(func(objs []unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+		renamed := map[string]string{}
+		for i := range objs {
+			obj := &objs[i]
+			if obj.GroupVersionKind().Group != "" || (obj.GetKind() != "ConfigMap" && obj.GetKind() != "Secret") {
+				continue
+			}
+			hash, err := contentHash(obj)
+			if err != nil {
+				return nil, fmt.Errorf("object %s: %w", objectID(obj), err)
+			}
+			name := obj.GetName() + "-" + hash
+			renamed[refKey(obj.GetKind(), obj.GetNamespace(), obj.GetName())] = name
+			obj.SetName(name)
+		}
+		if len(renamed) == 0 {
+			return objs, nil
+		}
+		for i := range objs {
+			rewriteRefs(objs[i].Object, func(kind, name string) string {
+				if newName, ok := renamed[refKey(kind, objs[i].GetNamespace(), name)]; ok {
+					return newName
+				}
+				return name
+			})
+		}
+		return objs, nil
+	})
+}
+
+func refKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+func contentHash(obj *unstructured.Unstructured) (string, error) {
+	content := map[string]interface{}{
+		"kind": obj.GetKind(),
+		"name": obj.GetName(),
+	}
+	fields := []string{"data", "binaryData"}
+	if obj.GetKind() == "Secret" {
+		fields = []string{"type", "data", "stringData"}
+	}
+	for _, field := range fields {
+		if value, ok := obj.Object[field]; ok {
+			content[field] = value
+		}
+	}
+	// maps are encoded with sorted keys, so the encoding is stable
+	data, err := json.Marshal(content)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode contents: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return encodeHash(hex.EncodeToString(sum[:])[:10]), nil
+}
+
+// encodeHash replaces vowels and some digits in the same way as kustomize,
+// so that hashes don't form words
+func encodeHash(hash string) string {
+	return strings.NewReplacer("0", "g", "1", "h", "3", "k", "a", "m", "e", "t").Replace(hash)
+}
+
+// rewriteRefs finds pod specs within the given value and calls rename for
+// each ConfigMap and Secret reference in volumes, envFrom, env valueFrom
+// and imagePullSecrets
+func rewriteRefs(value interface{}, rename func(kind, name string) string) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if _, ok := value["containers"].([]interface{}); ok {
+			rewritePodSpecRefs(value, rename)
+		}
+		for _, v := range value {
+			rewriteRefs(v, rename)
+		}
+	case []interface{}:
+		for _, v := range value {
+			rewriteRefs(v, rename)
+		}
+	}
+}
+
+func rewritePodSpecRefs(spec map[string]interface{}, rename func(kind, name string) string) {
+	ref := func(obj interface{}, kind string, path ...string) {
+		m, ok := obj.(map[string]interface{})
+		if !ok {
+			return
+		}
+		if name, ok, _ := unstructured.NestedString(m, path...); ok {
+			_ = unstructured.SetNestedField(m, rename(kind, name), path...)
+		}
+	}
+	each := func(obj interface{}, field string, f func(interface{})) {
+		m, ok := obj.(map[string]interface{})
+		if !ok {
+			return
+		}
+		if items, ok := m[field].([]interface{}); ok {
+			for _, item := range items {
+				f(item)
+			}
+		}
+	}
+
+	each(spec, "volumes", func(volume interface{}) {
+		ref(volume, "ConfigMap", "configMap", "name")
+		ref(volume, "Secret", "secret", "secretName")
+		if volume, ok := volume.(map[string]interface{}); ok {
+			each(volume["projected"], "sources", func(source interface{}) {
+				ref(source, "ConfigMap", "configMap", "name")
+				ref(source, "Secret", "secret", "name")
+			})
+		}
+	})
+	each(spec, "imagePullSecrets", func(secret interface{}) {
+		ref(secret, "Secret", "name")
+	})
+	for _, field := range []string{"containers", "initContainers", "ephemeralContainers"} {
+		each(spec, field, func(container interface{}) {
+			each(container, "envFrom", func(envFrom interface{}) {
+				ref(envFrom, "ConfigMap", "configMapRef", "name")
+				ref(envFrom, "Secret", "secretRef", "name")
+			})
+			each(container, "env", func(env interface{}) {
+				ref(env, "ConfigMap", "valueFrom", "configMapKeyRef", "name")
+				ref(env, "Secret", "valueFrom", "secretKeyRef", "name")
+			})
+		})
+	}
+}
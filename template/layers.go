@@ -0,0 +1,238 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DefaultsLayer is a named set of defaults, e.g. for an organisation or
+// an environment
+type DefaultsLayer struct {
+	Name  string
+	Value interface{}
+}
+
+// DefaultsSource records which layer supplied the value of a field
+type DefaultsSource struct {
+	// Path of the field within defaults, e.g. spec.location
+	Path string
+	// Layer that supplied the final value
+	Layer string
+	// Overrides lists earlier layers that supplied a value for the same field
+	Overrides []string `json:",omitempty"`
+}
+
+// WithDefaultsLayers merges the given layers in order and fills defaults
+// with the result; fields set in later layers override the same fields
+// in earlier layers, objects are merged and any other values, including
+// lists, are replaced; each layer must be valid on its own, and when
+// layers are not valid together, the error names both of the layers
+// that conflict
+func (g *Generator) WithDefaultsLayers(layers ...DefaultsLayer) (*Generator, error) {
+	values := make([]map[string]interface{}, len(layers))
+	for i, layer := range layers {
+		if _, err := g.with(Input{Path: g.slots.Defaults, Value: layer.Value}); err != nil {
+			return nil, fmt.Errorf("defaults layer %q is not valid: %w", layer.Name, err)
+		}
+		value, err := normalise(layer.Value)
+		if err != nil {
+			return nil, fmt.Errorf("defaults layer %q: %w", layer.Name, err)
+		}
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("defaults layer %q must be an object, not %s", layer.Name, typeName(value))
+		}
+		values[i] = obj
+	}
+
+	// layers are added one by one, so that the first conflicting layer is found
+	merged, sources := map[string]interface{}{}, map[string]*DefaultsSource{}
+	gen, err := g.with(Input{Path: g.slots.Defaults, Value: merged})
+	for i := 0; i < len(layers) && err == nil; i++ {
+		merged, sources, err = mergeLayers(layers[:i+1], values[:i+1])
+		if err != nil {
+			return nil, err
+		}
+		if gen, err = g.with(Input{Path: g.slots.Defaults, Value: merged}); err != nil {
+			return nil, g.layerConflict(layers, values, i, err)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	gen.defaultsSources = make([]DefaultsSource, 0, len(sources))
+	for _, source := range sources {
+		gen.defaultsSources = append(gen.defaultsSources, *source)
+	}
+	sort.Slice(gen.defaultsSources, func(i, j int) bool {
+		return gen.defaultsSources[i].Path < gen.defaultsSources[j].Path
+	})
+	return gen, nil
+}
+
+// layerConflict finds an earlier layer that layer i conflicts with
+func (g *Generator) layerConflict(layers []DefaultsLayer, values []map[string]interface{}, i int, err error) error {
+	for j := 0; j < i; j++ {
+		pair := []DefaultsLayer{layers[j], layers[i]}
+		merged, _, mergeErr := mergeLayers(pair, []map[string]interface{}{values[j], values[i]})
+		if mergeErr != nil {
+			return mergeErr
+		}
+		if _, pairErr := g.with(Input{Path: g.slots.Defaults, Value: merged}); pairErr != nil {
+			return fmt.Errorf("defaults layers %q and %q conflict: %w", layers[j].Name, layers[i].Name, pairErr)
+		}
+	}
+	return fmt.Errorf("defaults layer %q conflicts with earlier layers: %w", layers[i].Name, err)
+}
+
+func mergeLayers(layers []DefaultsLayer, values []map[string]interface{}) (map[string]interface{}, map[string]*DefaultsSource, error) {
+	merged, sources := map[string]interface{}{}, map[string]*DefaultsSource{}
+	for i := range layers {
+		value := runtime.DeepCopyJSON(values[i])
+		if err := mergeLayer(merged, value, nil, layers[i].Name, sources); err != nil {
+			return nil, nil, err
+		}
+	}
+	return merged, sources, nil
+}
+
+// DefaultsSources reports which layer supplied each field of defaults, it
+// is only set by WithDefaultsLayers
+func (g *Generator) DefaultsSources() []DefaultsSource {
+	return append([]DefaultsSource{}, g.defaultsSources...)
+}
+
+func mergeLayer(dst, src map[string]interface{}, path []string, layer string, sources map[string]*DefaultsSource) error {
+	for k, v := range src {
+		fieldPath := append(append([]string{}, path...), k)
+		key := strings.Join(fieldPath, ".")
+
+		existing, ok := dst[k]
+		if !ok {
+			dst[k] = v
+			setSources(v, fieldPath, layer, sources)
+			continue
+		}
+
+		existingObj, existingIsObj := existing.(map[string]interface{})
+		obj, isObj := v.(map[string]interface{})
+		switch {
+		case existingIsObj && isObj:
+			if err := mergeLayer(existingObj, obj, fieldPath, layer, sources); err != nil {
+				return err
+			}
+		case existingIsObj != isObj:
+			return fmt.Errorf("defaults layers %q and %q conflict at %q: %s cannot be merged with %s",
+				layerOf(key, sources), layer, key, typeName(existing), typeName(v))
+		default:
+			dst[k] = v
+			setSources(v, fieldPath, layer, sources)
+		}
+	}
+	return nil
+}
+
+// setSources records the layer for all leaves of v, any sources of fields
+// that v replaces are removed
+func setSources(v interface{}, path []string, layer string, sources map[string]*DefaultsSource) {
+	key := strings.Join(path, ".")
+	if obj, ok := v.(map[string]interface{}); ok && len(obj) != 0 {
+		for k, v := range obj {
+			setSources(v, append(append([]string{}, path...), k), layer, sources)
+		}
+		return
+	}
+	overrides := []string{}
+	for p, source := range sources {
+		if p == key || strings.HasPrefix(p, key+".") {
+			overrides = appendUnique(overrides, append(source.Overrides, source.Layer)...)
+			delete(sources, p)
+		}
+	}
+	source := &DefaultsSource{Path: key, Layer: layer}
+	if len(overrides) != 0 {
+		source.Overrides = overrides
+	}
+	sources[key] = source
+}
+
+func layerOf(key string, sources map[string]*DefaultsSource) string {
+	for p, source := range sources {
+		if p == key || strings.HasPrefix(p, key+".") {
+			return source.Layer
+		}
+	}
+	return ""
+}
+
+// normalise converts the value to its JSON form, with numbers decoded as
+// int64 or float64, so that values of any type can be merged
+func normalise(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode value: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("unable to decode value: %w", err)
+	}
+	return fixNumbers(value), nil
+}
+
+func fixNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = fixNumbers(v[k])
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = fixNumbers(v[i])
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+	}
+	return v
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "list"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case nil:
+		return "null"
+	default:
+		return "number"
+	}
+}
+
+func appendUnique(list []string, items ...string) []string {
+	for _, item := range items {
+		if !containsString(list, item) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,43 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package template
+
+import (
+	"fmt"
+
+	"cuelang.org/go/cue"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/errordeveloper/cue-utils/errors"
+)
+
+// metadataKey is the definition template packages can use to describe themselves
+const metadataKey = "#meta"
+
+// Metadata describes a template, all fields are optional; InputKind is the
+// apiVersion and kind of resources the template accepts
+type Metadata struct {
+	DisplayName string          `json:"displayName,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Owner       string          `json:"owner,omitempty"`
+	Version     string          `json:"version,omitempty"`
+	InputKind   metav1.TypeMeta `json:"inputKind,omitempty"`
+	Tags        []string        `json:"tags,omitempty"`
+}
+
+// Metadata returns metadata declared by the package, it is empty unless
+// the package declares it
+func (g *Generator) Metadata() Metadata { return g.metadata }
+
+func (g *Generator) resolveMetadata() error {
+	g.metadata = Metadata{}
+	declared := g.Value.LookupPath(cue.MakePath(cue.Def(metadataKey)))
+	if !declared.Exists() {
+		return nil
+	}
+	if err := declared.Decode(&g.metadata); err != nil {
+		return errors.Describe(fmt.Sprintf("unable to decode %q", metadataKey), err)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package template
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// RenderObjects renders the template as Kubernetes objects, the template
+// may be a single object, a list or a List kind, nested lists are flattened;
+// any transformers are applied to the objects, followed by provenance
+// annotations if WithProvenance is used, and objects are sorted if
+// WithObjectOrder is used; RenderJSON returns the template as is; if
+// WithObjectsOutput is used, the named output is rendered instead
+func (g *Generator) RenderObjects() ([]unstructured.Unstructured, error) {
+	if g.objectsOutput != "" {
+		return g.RenderObjectsFor(g.objectsOutput)
+	}
+	data, err := g.RenderJSON()
+	if err != nil {
+		return nil, err
+	}
+	return g.renderObjects(g.slots.Template, data)
+}
+
+// RenderObjectsFor is like RenderObjects, but renders the named output
+func (g *Generator) RenderObjectsFor(name string) ([]unstructured.Unstructured, error) {
+	data, err := g.Render(name)
+	if err != nil {
+		return nil, err
+	}
+	g.cue.LockMutex()
+	path := g.outputPath(name)
+	g.cue.UnlockMutex()
+	return g.renderObjects(path, data)
+}
+
+func (g *Generator) renderObjects(path string, data []byte) ([]unstructured.Unstructured, error) {
+	var rendered interface{}
+	if err := json.Unmarshal(data, &rendered); err != nil {
+		return nil, fmt.Errorf("unable to parse rendered JSON: %w", err)
+	}
+
+	objs := []unstructured.Unstructured{}
+	if err := flattenObjects(path, rendered, &objs); err != nil {
+		return nil, err
+	}
+	objs, err := g.transform(objs)
+	if err != nil {
+		return nil, err
+	}
+	if g.provenance {
+		if objs, err = g.annotateProvenance(objs); err != nil {
+			return nil, err
+		}
+	}
+	if g.kindOrder != nil {
+		return SortObjects(objs, g.kindOrder...)
+	}
+	return objs, nil
+}
+
+// RenderTypedObjects is like RenderObjects, but converts each object to
+// a typed object registered with the given scheme
+func (g *Generator) RenderTypedObjects(scheme *runtime.Scheme) ([]runtime.Object, error) {
+	objs, err := g.RenderObjects()
+	if err != nil {
+		return nil, err
+	}
+
+	typedObjs := make([]runtime.Object, 0, len(objs))
+	for i := range objs {
+		gvk := objs[i].GroupVersionKind()
+		typedObj, err := scheme.New(gvk)
+		if err != nil {
+			if runtime.IsNotRegisteredError(err) {
+				return nil, fmt.Errorf("unable to convert object %q (%s): kind %q is not registered in the scheme", objs[i].GetName(), gvk.GroupVersion(), gvk.Kind)
+			}
+			return nil, err
+		}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(objs[i].Object, typedObj); err != nil {
+			return nil, fmt.Errorf("unable to convert object %q (%s): %w", objs[i].GetName(), gvk, err)
+		}
+		typedObj.GetObjectKind().SetGroupVersionKind(gvk)
+		typedObjs = append(typedObjs, typedObj)
+	}
+	return typedObjs, nil
+}
+
+func flattenObjects(path string, rendered interface{}, objs *[]unstructured.Unstructured) error {
+	switch rendered := rendered.(type) {
+	case []interface{}:
+		for i := range rendered {
+			if err := flattenObjects(fmt.Sprintf("%s.%d", path, i), rendered[i], objs); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]interface{}:
+		obj := unstructured.Unstructured{Object: rendered}
+		if obj.GetAPIVersion() == "" || obj.GetKind() == "" {
+			return fmt.Errorf("%s: not a Kubernetes object, apiVersion and kind must be set", path)
+		}
+		if items, ok := rendered["items"].([]interface{}); ok && strings.HasSuffix(obj.GetKind(), "List") {
+			return flattenObjects(path+".items", items, objs)
+		}
+		*objs = append(*objs, obj)
+		return nil
+	default:
+		return fmt.Errorf("%s: not a Kubernetes object, unexpected type %T", path, rendered)
+	}
+}
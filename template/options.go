@@ -0,0 +1,148 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package template
+
+import (
+	"fmt"
+
+	"cuelang.org/go/cue"
+
+	"github.com/errordeveloper/cue-utils/errors"
+)
+
+const (
+	templateKey = "template"
+	defaultsKey = "defaults"
+	resourceKey = "resource"
+	outputsKey  = "outputs"
+
+	// slotsKey is the definition template packages can use to declare their own slot names
+	slotsKey = "#slots"
+)
+
+// Slots are the names of top-level fields that hold the rendered template,
+// named outputs, the defaults and the resource; empty names refer to the
+// default ones; Inputs are paths of any additional inputs accepted by the template
+type Slots struct {
+	Template string   `json:"template,omitempty"`
+	Outputs  string   `json:"outputs,omitempty"`
+	Defaults string   `json:"defaults,omitempty"`
+	Resource string   `json:"resource,omitempty"`
+	Inputs   []string `json:"inputs,omitempty"`
+}
+
+func defaultSlots() Slots {
+	return Slots{
+		Template: templateKey,
+		Outputs:  outputsKey,
+		Defaults: defaultsKey,
+		Resource: resourceKey,
+	}
+}
+
+func (s Slots) override(other Slots) Slots {
+	if other.Template != "" {
+		s.Template = other.Template
+	}
+	if other.Outputs != "" {
+		s.Outputs = other.Outputs
+	}
+	if other.Defaults != "" {
+		s.Defaults = other.Defaults
+	}
+	if other.Resource != "" {
+		s.Resource = other.Resource
+	}
+	inputs := append([]string{}, s.Inputs...)
+	for _, input := range other.Inputs {
+		if !containsString(inputs, input) {
+			inputs = append(inputs, input)
+		}
+	}
+	if len(inputs) != 0 {
+		s.Inputs = inputs
+	}
+	return s
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+type Option func(*Generator)
+
+// WithArgs sets the arguments passed to the CUE loader, by default "." is used
+func WithArgs(args ...string) Option {
+	return func(g *Generator) {
+		if len(args) != 0 {
+			g.args = args
+		}
+	}
+}
+
+// WithSlots renames the slots, it takes precedence over names declared by
+// the package itself
+func WithSlots(slots Slots) Option {
+	return func(g *Generator) {
+		g.slotOptions = g.slotOptions.override(slots)
+	}
+}
+
+// WithInputs declares additional inputs, in addition to any inputs declared
+// by the package itself
+func WithInputs(paths ...string) Option {
+	return func(g *Generator) {
+		g.slotOptions = g.slotOptions.override(Slots{Inputs: paths})
+	}
+}
+
+// WithObjectOrder makes RenderObjects sort objects by their dependencies and
+// kinds, using SortObjects with the given kinds
+func WithObjectOrder(kinds ...string) Option {
+	return func(g *Generator) {
+		g.kindOrder = append([]string{}, kinds...)
+	}
+}
+
+// WithObjectsOutput makes RenderObjects render the named output instead of
+// the template, which is needed for packages that only declare outputs
+func WithObjectsOutput(name string) Option {
+	return func(g *Generator) {
+		g.objectsOutput = name
+	}
+}
+
+// Configure applies options to an existing generator
+func (g *Generator) Configure(options ...Option) error {
+	for _, option := range options {
+		option(g)
+	}
+	return g.resolveSlots()
+}
+
+// Slots returns the slot names used by the generator
+func (g *Generator) Slots() Slots { return g.slots }
+
+// resolveSlots combines default slot names with names declared by the
+// package as well as given via options
+func (g *Generator) resolveSlots() error {
+	slots := defaultSlots()
+	if g.Value.Exists() {
+		declared := g.Value.LookupPath(cue.MakePath(cue.Def(slotsKey)))
+		if declared.Exists() {
+			declaredSlots := Slots{}
+			if err := declared.Decode(&declaredSlots); err != nil {
+				return errors.Describe(fmt.Sprintf("unable to decode %q", slotsKey), err)
+			}
+			slots = slots.override(declaredSlots)
+		}
+	}
+	g.slots = slots.override(g.slotOptions)
+	return nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package template
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// DependsOnAnnotation declares explicit dependencies of an object, it holds
+// a comma-separated list of object references in the same format as used by
+// kpt, i.e. "<group>/namespaces/<namespace>/<kind>/<name>" for namespaced and
+// "<group>/<kind>/<name>" for cluster-scoped objects, the group is empty for
+// core objects
+const DependsOnAnnotation = "config.kubernetes.io/depends-on"
+
+// DefaultKindOrder is the order in which objects of different kinds are
+// sorted, unless they depend on each other explicitly
+var DefaultKindOrder = []string{
+	"Namespace",
+	"CustomResourceDefinition",
+	"ServiceAccount",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"Role",
+	"RoleBinding",
+	"PriorityClass",
+	"StorageClass",
+	"PersistentVolume",
+	"PersistentVolumeClaim",
+	"ResourceQuota",
+	"LimitRange",
+	"ConfigMap",
+	"Secret",
+	"Service",
+	"DaemonSet",
+	"Deployment",
+	"StatefulSet",
+	"ReplicaSet",
+	"Pod",
+	"Job",
+	"CronJob",
+}
+
+// SortObjects returns objects ordered such that each object comes after
+// its explicit dependencies, otherwise objects are ordered by kind as given,
+// or as in DefaultKindOrder if no kinds are given; objects of kinds that are
+// not listed come last and the original order is kept for objects of the
+// same kind; dependencies on objects that are not given are ignored
+func SortObjects(objs []unstructured.Unstructured, kinds ...string) ([]unstructured.Unstructured, error) {
+	if len(kinds) == 0 {
+		kinds = DefaultKindOrder
+	}
+	rank := make(map[string]int, len(kinds))
+	for i, kind := range kinds {
+		if _, ok := rank[kind]; !ok {
+			rank[kind] = i
+		}
+	}
+	rankOf := func(i int) int {
+		if r, ok := rank[objs[i].GetKind()]; ok {
+			return r
+		}
+		return len(kinds)
+	}
+
+	ids := make(map[string][]int, len(objs))
+	for i := range objs {
+		id := objectID(&objs[i])
+		ids[id] = append(ids[id], i)
+	}
+
+	deps := make([][]int, len(objs))
+	dependents := make([][]int, len(objs))
+	pending := make([]int, len(objs))
+	for i := range objs {
+		refs, err := dependsOn(&objs[i])
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range refs {
+			for _, j := range ids[ref] {
+				deps[i] = append(deps[i], j)
+				dependents[j] = append(dependents[j], i)
+				pending[i]++
+			}
+		}
+	}
+
+	sorted := make([]unstructured.Unstructured, 0, len(objs))
+	done := make([]bool, len(objs))
+	for len(sorted) < len(objs) {
+		next := -1
+		for i := range objs {
+			if done[i] || pending[i] != 0 {
+				continue
+			}
+			if next == -1 || rankOf(i) < rankOf(next) {
+				next = i
+			}
+		}
+		if next == -1 {
+			return nil, fmt.Errorf("dependency cycle between objects: %s", strings.Join(cycle(objs, deps, done), " -> "))
+		}
+		done[next] = true
+		sorted = append(sorted, objs[next])
+		for _, i := range dependents[next] {
+			pending[i]--
+		}
+	}
+	return sorted, nil
+}
+
+// cycle finds a cycle among objects that are not done yet, it assumes
+// that each of these has at least one dependency that is not done
+func cycle(objs []unstructured.Unstructured, deps [][]int, done []bool) []string {
+	visited := map[int]int{}
+	path := []int{}
+	i := 0
+	for done[i] {
+		i++
+	}
+	for {
+		if start, ok := visited[i]; ok {
+			ids := []string{}
+			for _, j := range append(path[start:], i) {
+				ids = append(ids, objectID(&objs[j]))
+			}
+			return ids
+		}
+		visited[i] = len(path)
+		path = append(path, i)
+		for _, j := range deps[i] {
+			if !done[j] {
+				i = j
+				break
+			}
+		}
+	}
+}
+
+func objectID(obj *unstructured.Unstructured) string {
+	group := obj.GroupVersionKind().Group
+	if obj.GetNamespace() == "" {
+		return strings.Join([]string{group, obj.GetKind(), obj.GetName()}, "/")
+	}
+	return strings.Join([]string{group, "namespaces", obj.GetNamespace(), obj.GetKind(), obj.GetName()}, "/")
+}
+
+func dependsOn(obj *unstructured.Unstructured) ([]string, error) {
+	annotation, ok := obj.GetAnnotations()[DependsOnAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	refs := []string{}
+	for _, ref := range strings.Split(annotation, ",") {
+		ref = strings.TrimSpace(ref)
+		parts := strings.Split(ref, "/")
+		switch {
+		case len(parts) == 3 && parts[1] != "" && parts[2] != "":
+		case len(parts) == 5 && parts[1] == "namespaces" && parts[2] != "" && parts[3] != "" && parts[4] != "":
+		default:
+			return nil, fmt.Errorf("invalid %q annotation on object %s: unexpected reference %q", DependsOnAnnotation, objectID(obj), ref)
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"cuelang.org/go/cue"
+
+	"github.com/errordeveloper/cue-utils/errors"
+)
+
+// placeholderFormat is used for fields that are not concrete in a preview
+const placeholderFormat = "<missing: %s>"
+
+// PreviewJSON is like RenderJSON, but fields that are not concrete yet are
+// replaced with a placeholder string naming the inputs they depend on, e.g.
+// "<missing: resource.metadata.name>", or the path of the field itself
+// if it doesn't depend on any inputs
+func (g *Generator) PreviewJSON() ([]byte, error) {
+	g.cue.LockMutex()
+	defer g.cue.UnlockMutex()
+
+	return g.previewJSON(g.slots.Template, "unable to preview JSON")
+}
+
+// Preview is like Render, but renders placeholders the same way as PreviewJSON
+func (g *Generator) Preview(name string) ([]byte, error) {
+	g.cue.LockMutex()
+	defer g.cue.UnlockMutex()
+
+	outputs, err := g.outputs()
+	if err != nil {
+		return nil, err
+	}
+	if !containsString(outputs, name) {
+		return nil, fmt.Errorf("unknown output %q (outputs: %v)", name, outputs)
+	}
+	return g.previewJSON(g.outputPath(name), fmt.Sprintf("unable to preview output %q", name))
+}
+
+func (g *Generator) previewJSON(path, desc string) ([]byte, error) {
+	keyPath := cue.ParsePath(path)
+	if err := keyPath.Err(); err != nil {
+		return nil, err
+	}
+
+	val := g.Value.LookupPath(keyPath)
+	if !val.Exists() {
+		return nil, fmt.Errorf("unable to lookup path %q: %w", path, val.Err())
+	}
+	// conflicts would still prevent rendering, only incomplete values are allowed
+	if err := val.Validate(); err != nil {
+		err = errors.Describe(desc, errors.CollectFrom(g.Value, g.cue.MaxErrors(), err))
+		return nil, errors.Redact(err, g.sensitivePaths(g.Value))
+	}
+
+	// previews are not real output, so sensitive values are always redacted
+	buf := &bytes.Buffer{}
+	if err := g.writeValue(val, buf, g.sensitive); err != nil {
+		return nil, errors.Redact(errors.Describe(desc, err), g.sensitivePaths(g.Value))
+	}
+	return buf.Bytes(), nil
+}
+
+// writeValue writes the value as JSON, keeping the order of fields; values
+// that are not concrete are written as placeholders, and sensitive values
+// are redacted if requested
+func (g *Generator) writeValue(v cue.Value, buf *bytes.Buffer, redact bool) error {
+	switch v.IncompleteKind() {
+	case cue.StructKind:
+		if iter, err := v.Fields(); err == nil {
+			buf.WriteByte('{')
+			for i := 0; iter.Next(); i++ {
+				if i != 0 {
+					buf.WriteByte(',')
+				}
+				if err := writeJSON(buf, iter.Label()); err != nil {
+					return err
+				}
+				buf.WriteByte(':')
+				if err := g.writeValue(iter.Value(), buf, redact); err != nil {
+					return err
+				}
+			}
+			buf.WriteByte('}')
+			return nil
+		}
+	case cue.ListKind:
+		if iter, err := v.List(); err == nil {
+			buf.WriteByte('[')
+			for i := 0; iter.Next(); i++ {
+				if i != 0 {
+					buf.WriteByte(',')
+				}
+				if err := g.writeValue(iter.Value(), buf, redact); err != nil {
+					return err
+				}
+			}
+			buf.WriteByte(']')
+			return nil
+		}
+	}
+
+	if v.IsConcrete() {
+		if redact && g.isSensitiveLeaf(v) {
+			return writeJSON(buf, errors.Redacted)
+		}
+		data, err := v.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		return nil
+	}
+
+	dependsOn := []string{}
+	g.dependencies(v, map[string]struct{}{}, &dependsOn)
+	if len(dependsOn) == 0 {
+		dependsOn = append(dependsOn, v.Path().String())
+	}
+	return writeJSON(buf, fmt.Sprintf(placeholderFormat, strings.Join(dependsOn, ", ")))
+}
+
+func writeJSON(buf *bytes.Buffer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	buf.Write(data)
+	return nil
+}
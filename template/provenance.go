@@ -0,0 +1,108 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package template
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/format"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const modulePath = "github.com/errordeveloper/cue-utils"
+
+// Annotations added to rendered objects when WithProvenance is used
+const (
+	TemplateAnnotation       = "cue-utils.errordeveloper.com/template"
+	TemplateDigestAnnotation = "cue-utils.errordeveloper.com/template-digest"
+	InputsDigestAnnotation   = "cue-utils.errordeveloper.com/inputs-digest"
+	VersionAnnotation        = "cue-utils.errordeveloper.com/version"
+)
+
+// WithProvenance makes RenderObjects annotate every object with the import
+// path and digest of the template, digest of the inputs and version of
+// cue-utils, so it's possible to tell how an object was produced
+func WithProvenance() Option {
+	return func(g *Generator) {
+		g.provenance = true
+	}
+}
+
+// Version returns version of cue-utils module used by the binary, or
+// "(devel)" when it cannot be determined
+func Version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(devel)"
+	}
+	if info.Main.Path == modulePath {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			if dep.Replace != nil {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+	return "(devel)"
+}
+
+// TemplateDigest returns digest of the template package, as it was compiled,
+// it doesn't change with formatting or comments; imported packages are only
+// referred to by their import paths
+func (g *Generator) TemplateDigest() string { return g.templateDigest }
+
+// InputsDigest returns digest of all inputs applied to the generator, values
+// of sensitive fields are left out, so that the digest cannot be used to
+// guess these
+func (g *Generator) InputsDigest() (string, error) {
+	g.cue.LockMutex()
+	defer g.cue.UnlockMutex()
+
+	data, err := json.Marshal(g.redactLineage())
+	if err != nil {
+		return "", fmt.Errorf("unable to encode inputs: %w", err)
+	}
+	return digest(data), nil
+}
+
+func (g *Generator) resolveTemplateDigest() error {
+	data, err := format.Node(g.Value.Syntax(
+		cue.Docs(false),
+		cue.Attributes(true),
+		cue.Definitions(true),
+		cue.Hidden(true),
+		cue.Optional(true),
+	))
+	if err != nil {
+		return fmt.Errorf("unable to format template: %w", err)
+	}
+	g.templateDigest = digest(data)
+	return nil
+}
+
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func (g *Generator) annotateProvenance(objs []unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+	inputsDigest, err := g.InputsDigest()
+	if err != nil {
+		return nil, err
+	}
+	return SetAnnotations(map[string]string{
+		TemplateAnnotation:       g.ImportPath,
+		TemplateDigestAnnotation: g.templateDigest,
+		InputsDigestAnnotation:   inputsDigest,
+		VersionAnnotation:        Version(),
+	}).Transform(objs)
+}
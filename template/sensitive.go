@@ -0,0 +1,325 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package template
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/format"
+	"cuelang.org/go/cue/token"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/errordeveloper/cue-utils/errors"
+)
+
+// sensitiveAttr marks fields with values that must not be disclosed,
+// e.g. `password: string @sensitive()`
+const sensitiveAttr = "sensitive"
+
+// WithSensitiveOutput allows values of sensitive fields to appear in rendered
+// output, otherwise these are redacted, along with any values derived from
+// them; errors, previews and dumps are always redacted
+func WithSensitiveOutput() Option {
+	return func(g *Generator) {
+		g.allowSensitive = true
+	}
+}
+
+// Redact replaces values in messages of errors at paths of sensitive fields,
+// or of fields derived from them, it should be used for any errors that are
+// logged and might contain values of the generator
+func (g *Generator) Redact(err error) error {
+	g.cue.LockMutex()
+	defer g.cue.UnlockMutex()
+
+	return errors.Redact(err, g.sensitivePaths(g.Value))
+}
+
+// Dump formats the value of the generator as CUE with values of sensitive
+// fields redacted, it should be used instead of printing the value directly
+func (g *Generator) Dump() (string, error) {
+	g.cue.LockMutex()
+	defer g.cue.UnlockMutex()
+
+	syntax := g.Value.Syntax(cue.Docs(true), cue.Attributes(true), cue.Optional(true), cue.Definitions(true), cue.Hidden(true))
+	if g.sensitive {
+		g.redactSyntax(syntax, []cue.Selector{}, false)
+	}
+	data, err := format.Node(syntax)
+	if err != nil {
+		return "", fmt.Errorf("unable to format value: %w", err)
+	}
+	return string(data), nil
+}
+
+// resolveSensitive checks whether the template has any sensitive fields, so
+// that redaction can be skipped entirely otherwise; fields are looked up in the
+// value, which includes imported definitions, as well as in the syntax, which
+// includes pattern constraints
+func (g *Generator) resolveSensitive() {
+	g.sensitive = false
+	walkSensitive(g.Value, func(cue.Value) { g.sensitive = true })
+	if g.sensitive {
+		return
+	}
+	syntax := g.Value.Syntax(cue.Attributes(true), cue.Definitions(true), cue.Hidden(true), cue.Optional(true))
+	ast.Walk(syntax, func(node ast.Node) bool {
+		if attr, ok := node.(*ast.Attribute); ok {
+			if key, _ := attr.Split(); key == sensitiveAttr {
+				g.sensitive = true
+			}
+		}
+		return !g.sensitive
+	}, nil)
+}
+
+// sensitivePaths returns a function that checks whether a path within any
+// of the given values is a sensitive field, or is derived from one; it
+// returns nil if the template has no sensitive fields
+func (g *Generator) sensitivePaths(values ...cue.Value) func(cue.Path) bool {
+	if !g.sensitive {
+		return nil
+	}
+	return func(path cue.Path) bool {
+		for _, v := range values {
+			if isSensitivePath(v, path) || references(v.LookupPath(path), map[string]struct{}{}) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// walkSensitive calls f for every field that is marked as sensitive, fields
+// within these are not visited
+func walkSensitive(v cue.Value, f func(cue.Value)) {
+	switch v.IncompleteKind() {
+	case cue.StructKind:
+		iter, err := v.Fields(cue.Optional(true), cue.Definitions(true), cue.Hidden(true))
+		if err != nil {
+			return
+		}
+		for iter.Next() {
+			if isSensitive(iter.Value()) {
+				f(iter.Value())
+				continue
+			}
+			walkSensitive(iter.Value(), f)
+		}
+	case cue.ListKind:
+		iter, err := v.List()
+		if err != nil {
+			return
+		}
+		for iter.Next() {
+			walkSensitive(iter.Value(), f)
+		}
+	}
+}
+
+func isSensitive(v cue.Value) bool {
+	attr := v.Attribute(sensitiveAttr)
+	return attr.Err() == nil
+}
+
+// isSensitivePath checks whether the field at the given path, or any of its
+// parents, is marked as sensitive
+func isSensitivePath(root cue.Value, path cue.Path) bool {
+	selectors := path.Selectors()
+	for i := len(selectors); i > 0; i-- {
+		if isSensitive(root.LookupPath(cue.MakePath(selectors[:i]...))) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSensitiveLeaf checks whether a value within the output is a sensitive field
+// itself, or is derived from one, e.g. by reference or string interpolation;
+// other values are never redacted, even if they happen to be the same
+func (g *Generator) isSensitiveLeaf(v cue.Value) bool {
+	return isSensitivePath(g.Value, v.Path()) || references(v, map[string]struct{}{})
+}
+
+// references checks whether the value refers to any sensitive fields, any
+// other references (e.g. to intermediate variables) are followed
+func references(v cue.Value, visited map[string]struct{}) bool {
+	if root, path := v.ReferencePath(); len(path.Selectors()) != 0 {
+		ref := path.String()
+		if _, ok := visited[ref]; ok {
+			return false
+		}
+		visited[ref] = struct{}{}
+
+		if isSensitivePath(root, path) {
+			return true
+		}
+		return references(root.LookupPath(path), visited)
+	}
+
+	op, args := v.Expr()
+	if op == cue.NoOp && len(args) == 1 {
+		return false
+	}
+	for _, arg := range args {
+		if references(arg, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactLineage returns a copy of the inputs with values of sensitive fields
+// redacted; inputs that contain any are converted to generic values, as
+// documents cannot be redacted, and inputs that cannot be converted are
+// redacted entirely
+func (g *Generator) redactLineage() []Input {
+	lineage := append([]Input{}, g.lineage...)
+	if !g.sensitive {
+		return lineage
+	}
+	for i, input := range lineage {
+		path := cue.ParsePath(input.Path).Selectors()
+		value, err := genericValueOf(input)
+		if err != nil {
+			lineage[i] = Input{Path: input.Path, Value: errors.Redacted, Filename: input.Filename}
+			continue
+		}
+		if value, redacted := g.redactInput(value, path); redacted {
+			lineage[i] = Input{Path: input.Path, Value: value, Filename: input.Filename}
+		}
+	}
+	return lineage
+}
+
+func genericValueOf(input Input) (interface{}, error) {
+	data, err := json.Marshal(input.Value)
+	if input.Data != nil {
+		data, err = yaml.YAMLToJSON(input.Data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// redactInput replaces values of sensitive fields within an input value at
+// the given path, it reports whether any values were replaced
+func (g *Generator) redactInput(value interface{}, path []cue.Selector) (interface{}, bool) {
+	if isSensitivePath(g.Value, cue.MakePath(path...)) {
+		return errors.Redacted, true
+	}
+	redacted := false
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for k := range value {
+			var ok bool
+			if value[k], ok = g.redactInput(value[k], append(path[:len(path):len(path)], cue.Str(k))); ok {
+				redacted = true
+			}
+		}
+	case []interface{}:
+		for i := range value {
+			var ok bool
+			if value[i], ok = g.redactInput(value[i], append(path[:len(path):len(path)], cue.Index(i))); ok {
+				redacted = true
+			}
+		}
+	}
+	return value, redacted
+}
+
+// redactSyntax replaces literals of sensitive fields in the syntax of the
+// value, fields are matched by their path, as the syntax doesn't necessarily
+// carry the attributes, e.g. when a field is filled into a definition;
+// expressions are left as they are, as they don't contain values of inputs
+func (g *Generator) redactSyntax(node ast.Node, path []cue.Selector, sensitive bool) {
+	switch node := node.(type) {
+	case *ast.File:
+		for _, decl := range node.Decls {
+			g.redactSyntax(decl, path, sensitive)
+		}
+	case *ast.StructLit:
+		for _, elt := range node.Elts {
+			g.redactSyntax(elt, path, sensitive)
+		}
+	case *ast.EmbedDecl:
+		node.Expr = g.redactExpr(node.Expr, path, sensitive)
+	case *ast.Field:
+		fieldSensitive := sensitive || hasSensitiveAttr(node)
+		var fieldPath []cue.Selector
+		if path != nil {
+			if sel, ok := selectorOf(node.Label); ok {
+				fieldPath = append(append([]cue.Selector{}, path...), sel)
+				fieldSensitive = fieldSensitive || isSensitive(g.Value.LookupPath(cue.MakePath(fieldPath...)))
+			}
+		}
+		node.Value = g.redactExpr(node.Value, fieldPath, fieldSensitive)
+	}
+}
+
+func (g *Generator) redactExpr(expr ast.Expr, path []cue.Selector, sensitive bool) ast.Expr {
+	switch expr := expr.(type) {
+	case *ast.BasicLit, *ast.Interpolation:
+		if sensitive {
+			return ast.NewString(errors.Redacted)
+		}
+	case *ast.StructLit:
+		g.redactSyntax(expr, path, sensitive)
+	case *ast.ListLit:
+		for i := range expr.Elts {
+			var elemPath []cue.Selector
+			if path != nil {
+				elemPath = append(append([]cue.Selector{}, path...), cue.Index(i))
+			}
+			expr.Elts[i] = g.redactExpr(expr.Elts[i], elemPath, sensitive)
+		}
+	case *ast.BinaryExpr:
+		expr.X = g.redactExpr(expr.X, path, sensitive)
+		expr.Y = g.redactExpr(expr.Y, path, sensitive)
+	case *ast.ParenExpr:
+		expr.X = g.redactExpr(expr.X, path, sensitive)
+	case *ast.UnaryExpr:
+		// only defaults are values, other operators are constraints
+		if expr.Op == token.MUL {
+			expr.X = g.redactExpr(expr.X, path, sensitive)
+		}
+	}
+	return expr
+}
+
+func hasSensitiveAttr(field *ast.Field) bool {
+	for _, attr := range field.Attrs {
+		if key, _ := attr.Split(); key == sensitiveAttr {
+			return true
+		}
+	}
+	return false
+}
+
+// selectorOf converts a regular or definition label to a selector, other
+// labels (e.g. hidden fields or patterns) cannot be looked up
+func selectorOf(label ast.Label) (cue.Selector, bool) {
+	name, isIdent, err := ast.LabelName(label)
+	if err != nil {
+		return cue.Selector{}, false
+	}
+	switch {
+	case isIdent && strings.HasPrefix(name, "#"):
+		return cue.Def(name), true
+	case isIdent && strings.HasPrefix(name, "_"):
+		return cue.Selector{}, false
+	default:
+		return cue.Str(name), true
+	}
+}
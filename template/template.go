@@ -5,8 +5,11 @@
 package template
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"reflect"
+	"strings"
 
 	"cuelang.org/go/cue"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -15,30 +18,56 @@ import (
 	"github.com/errordeveloper/cue-utils/errors"
 )
 
-const (
-	templateKey = "template"
-	defaultsKey = "defaults"
-	resourceKey = "resource"
-)
-
 type Generator struct {
 	dir  string
 	args []string
 	cue  *compiler.Compiler
 
+	slots, slotOptions Slots
+
+	metadata Metadata
+
+	// kindOrder is nil, unless objects are to be sorted
+	kindOrder []string
+
+	// objectsOutput is empty, unless RenderObjects renders a named output
+	objectsOutput string
+
+	transformers []Transformer
+
+	batchWorkers int
+
+	provenance     bool
+	templateDigest string
+
+	defaultsSources []DefaultsSource
+
+	// sensitive is set if the template has any sensitive fields
+	sensitive, allowSensitive bool
+
+	lineage []Input
+
 	Value      cue.Value
 	ImportPath string
 }
 
 func NewGenerator(dir string, args ...string) *Generator {
-	if len(args) == 0 {
-		args = []string{"."}
+	return New(dir, WithArgs(args...))
+}
+
+// New is like NewGenerator, but accepts options
+func New(dir string, options ...Option) *Generator {
+	g := &Generator{
+		args:  []string{"."},
+		dir:   dir,
+		cue:   compiler.NewCompiler(),
+		slots: defaultSlots(),
 	}
-	return &Generator{
-		args: args,
-		dir:  dir,
-		cue:  compiler.NewCompiler(),
+	for _, option := range options {
+		option(g)
 	}
+	g.slots = g.slots.override(g.slotOptions)
+	return g
 }
 
 func (g *Generator) CompileAndValidate() error {
@@ -49,65 +78,357 @@ func (g *Generator) CompileAndValidate() error {
 
 	g.Value = val.Value
 	g.ImportPath = val.ImportPath
-	return nil
+	if err := g.resolveMetadata(); err != nil {
+		return err
+	}
+	if err := g.resolveTemplateDigest(); err != nil {
+		return err
+	}
+	g.resolveSensitive()
+	return g.resolveSlots()
 }
 
 func (g *Generator) Compiler() *compiler.Compiler { return g.cue }
 
-type k8sWrapper struct{ runtime.Object }
+// toUnstructured converts values of types that are or contain Kubernetes types
+// to unstructured form, since CUE doesn't handle inline fields of these types;
+// maps and slices are converted element by element, values of other types are
+// returned as is
+func toUnstructured(obj interface{}) (interface{}, error) {
+	if obj == nil {
+		return obj, nil
+	}
+	if _, ok := obj.(json.Marshaler); ok {
+		// e.g. resource.Quantity or metav1.Time, CUE uses custom marshalling
+		return obj, nil
+	}
+	v := reflect.ValueOf(obj)
+	if !containsKubernetesTypes(v.Type(), map[reflect.Type]bool{}) {
+		return obj, nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return obj, nil
+		}
+		return toUnstructured(v.Elem().Interface())
+	case reflect.Struct:
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		return runtime.DefaultUnstructuredConverter.ToUnstructured(ptr.Interface())
+	case reflect.Map:
+		if v.IsNil() || v.Type().Key().Kind() != reflect.String {
+			return obj, nil
+		}
+		converted := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			value, err := toUnstructured(iter.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+			converted[iter.Key().String()] = value
+		}
+		return converted, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return obj, nil
+		}
+		converted := make([]interface{}, v.Len())
+		for i := range converted {
+			value, err := toUnstructured(v.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			converted[i] = value
+		}
+		return converted, nil
+	}
+	return obj, nil
+}
+
+// containsKubernetesTypes checks whether values of the given type could
+// contain Kubernetes types, which is always the case for interfaces
+func containsKubernetesTypes(t reflect.Type, seen map[reflect.Type]bool) bool {
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return containsKubernetesTypes(t.Elem(), seen)
+	case reflect.Struct:
+		if seen[t] {
+			return false
+		}
+		seen[t] = true
+		if strings.HasPrefix(t.PkgPath(), "k8s.io/") {
+			return true
+		}
+		for i := 0; i < t.NumField(); i++ {
+			if containsKubernetesTypes(t.Field(i).Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Input records a value that was filled into a derived generator, either
+// an object or a YAML or JSON document; note that objects are recorded by
+// reference, so these should not be modified once used
+type Input struct {
+	Path     string
+	Value    interface{} `json:",omitempty"`
+	Filename string      `json:",omitempty"`
+	Data     []byte      `json:",omitempty"`
+}
 
-func (w *k8sWrapper) MarshalJSON() ([]byte, error) { return json.Marshal(w.Object) }
+func (g *Generator) with(input Input) (*Generator, error) {
+	obj := input.Value
+	if input.Data != nil {
+		val, err := g.cue.CompileData(input.Filename, input.Data)
+		if err != nil {
+			return nil, err
+		}
+		obj = val
+	} else {
+		converted, err := toUnstructured(obj)
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert value for path %q: %w", input.Path, err)
+		}
+		obj = converted
+	}
 
-func (g *Generator) with(key string, obj interface{}) (*Generator, error) {
 	g.cue.LockMutex()
 	defer g.cue.UnlockMutex()
 
+	key := input.Path
 	keyPath := cue.ParsePath(key)
 	if err := keyPath.Err(); err != nil {
 		return nil, err
 	}
 
-	// temporary fix for CUE bug reproduced in https://github.com/errordeveloper/cue-utils/pull/1
-	if rtObj, isRuntimeObject := obj.(runtime.Object); isRuntimeObject {
-		obj = &k8sWrapper{Object: rtObj}
-	}
-
 	val := g.Value.FillPath(keyPath, obj)
 	if err := val.Err(); err != nil {
-		return nil, errors.Describe(fmt.Sprintf("unable to fill path %q", key), err)
+		// val.Err only reports the first error, validation will find all the others
+		err = errors.Describe(fmt.Sprintf("unable to fill path %q", key), errors.CollectFrom(val, g.cue.MaxErrors(), err, val.Validate()))
+		return nil, errors.Redact(err, g.sensitivePaths(g.Value, val))
+	}
+	derived := *g
+	derived.lineage = append(append([]Input{}, g.lineage...), input)
+	derived.Value = val
+	return &derived, nil
+}
+
+// Lineage returns all inputs applied to the generator, in order; values of
+// sensitive fields are redacted, unless WithSensitiveOutput is used
+func (g *Generator) Lineage() []Input {
+	g.cue.LockMutex()
+	defer g.cue.UnlockMutex()
+
+	if g.allowSensitive {
+		return append([]Input{}, g.lineage...)
+	}
+	return g.redactLineage()
+}
+
+// Replay applies the given inputs in order, it can be used with the lineage
+// of another generator
+func (g *Generator) Replay(inputs []Input) (*Generator, error) {
+	gen := g
+	for i, input := range inputs {
+		next, err := gen.with(input)
+		if err != nil {
+			return nil, fmt.Errorf("unable to replay input %d (path: %q): %w", i, input.Path, err)
+		}
+		gen = next
 	}
-	return &Generator{
-		dir:   g.dir,
-		Value: val,
-		cue:   g.cue,
-	}, nil
+	return gen, nil
+}
+
+// Recompile compiles the template afresh and replays the lineage, which is
+// useful for reproducing issues
+func (g *Generator) Recompile() (*Generator, error) {
+	fresh := *g
+	fresh.cue = compiler.NewCompiler()
+	fresh.cue.SetMaxErrors(g.cue.MaxErrors())
+	fresh.lineage = nil
+	if err := fresh.CompileAndValidate(); err != nil {
+		return nil, err
+	}
+	return fresh.Replay(g.lineage)
 }
 
 func (g *Generator) WithDefaults(obj interface{}) (*Generator, error) {
-	return g.with(defaultsKey, obj)
+	return g.with(Input{Path: g.slots.Defaults, Value: obj})
 }
 
 func (g *Generator) WithResource(obj interface{}) (*Generator, error) {
-	return g.with(resourceKey, obj)
+	return g.with(Input{Path: g.slots.Resource, Value: obj})
+}
+
+// Inputs returns paths of all inputs accepted by the template, i.e. defaults,
+// resource and any additional declared inputs
+func (g *Generator) Inputs() []string {
+	return append([]string{g.slots.Defaults, g.slots.Resource}, g.slots.Inputs...)
+}
+
+// WithInput fills the given path, which must be a declared input or
+// a field within one
+func (g *Generator) WithInput(path string, obj interface{}) (*Generator, error) {
+	if err := g.checkInput(path); err != nil {
+		return nil, err
+	}
+	return g.with(Input{Path: path, Value: obj})
+}
+
+func (g *Generator) checkInput(path string) error {
+	inputPath := cue.ParsePath(path)
+	if err := inputPath.Err(); err != nil {
+		return err
+	}
+	for _, input := range g.Inputs() {
+		declaredPath := cue.ParsePath(input)
+		if declaredPath.Err() != nil {
+			continue
+		}
+		if hasPrefix(inputPath.Selectors(), declaredPath.Selectors()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q is not a declared input (inputs: %v)", path, g.Inputs())
+}
+
+func hasPrefix(path, prefix []cue.Selector) bool {
+	if len(path) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if path[i].String() != prefix[i].String() {
+			return false
+		}
+	}
+	return true
+}
+
+// WithDefaultsData fills defaults from a YAML or JSON document, errors will
+// refer to positions within the given file as well as the template
+func (g *Generator) WithDefaultsData(filename string, data []byte) (*Generator, error) {
+	return g.with(Input{Path: g.slots.Defaults, Filename: filename, Data: data})
+}
+
+// WithResourceData fills resource from a YAML or JSON document, errors will
+// refer to positions within the given file as well as the template
+func (g *Generator) WithResourceData(filename string, data []byte) (*Generator, error) {
+	return g.with(Input{Path: g.slots.Resource, Filename: filename, Data: data})
 }
 
 func (g *Generator) RenderJSON() ([]byte, error) {
 	g.cue.LockMutex()
 	defer g.cue.UnlockMutex()
 
-	templateKeyPath := cue.ParsePath(templateKey)
-	if err := templateKeyPath.Err(); err != nil {
+	if g.hasOutputs() && !g.Value.LookupPath(cue.ParsePath(g.slots.Template)).Exists() {
+		outputs, err := g.outputs()
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("package doesn't define %q, it only declares named outputs %v, use Render or RenderObjectsFor instead", g.slots.Template, outputs)
+	}
+	return g.renderJSON(g.slots.Template, "unable to render JSON")
+}
+
+// Outputs returns names of all outputs declared by the template; a template
+// without any named outputs has a single output named after the template slot
+func (g *Generator) Outputs() ([]string, error) {
+	g.cue.LockMutex()
+	defer g.cue.UnlockMutex()
+
+	return g.outputs()
+}
+
+// Render renders the named output as JSON
+func (g *Generator) Render(name string) ([]byte, error) {
+	g.cue.LockMutex()
+	defer g.cue.UnlockMutex()
+
+	outputs, err := g.outputs()
+	if err != nil {
 		return nil, err
 	}
+	if !containsString(outputs, name) {
+		return nil, fmt.Errorf("unknown output %q (outputs: %v)", name, outputs)
+	}
+	return g.renderJSON(g.outputPath(name), fmt.Sprintf("unable to render output %q", name))
+}
 
-	val := g.Value.LookupPath(templateKeyPath)
+// RenderAll renders every output as JSON
+func (g *Generator) RenderAll() (map[string][]byte, error) {
+	g.cue.LockMutex()
+	defer g.cue.UnlockMutex()
+
+	outputs, err := g.outputs()
+	if err != nil {
+		return nil, err
+	}
+	rendered := make(map[string][]byte, len(outputs))
+	for _, name := range outputs {
+		data, err := g.renderJSON(g.outputPath(name), fmt.Sprintf("unable to render output %q", name))
+		if err != nil {
+			return nil, err
+		}
+		rendered[name] = data
+	}
+	return rendered, nil
+}
+
+func (g *Generator) hasOutputs() bool {
+	return g.Value.LookupPath(cue.ParsePath(g.slots.Outputs)).Exists()
+}
+
+func (g *Generator) outputs() ([]string, error) {
+	if !g.hasOutputs() {
+		return []string{g.slots.Template}, nil
+	}
+	iter, err := g.Value.LookupPath(cue.ParsePath(g.slots.Outputs)).Fields()
+	if err != nil {
+		return nil, errors.Describe(fmt.Sprintf("unable to list outputs in %q", g.slots.Outputs), err)
+	}
+	outputs := []string{}
+	for iter.Next() {
+		outputs = append(outputs, iter.Label())
+	}
+	return outputs, nil
+}
+
+func (g *Generator) outputPath(name string) string {
+	if !g.hasOutputs() {
+		return g.slots.Template
+	}
+	return cue.MakePath(append(cue.ParsePath(g.slots.Outputs).Selectors(), cue.Str(name))...).String()
+}
+
+func (g *Generator) renderJSON(path, desc string) ([]byte, error) {
+	keyPath := cue.ParsePath(path)
+	if err := keyPath.Err(); err != nil {
+		return nil, err
+	}
+
+	val := g.Value.LookupPath(keyPath)
 	if err := val.Err(); err != nil {
-		return nil, fmt.Errorf("unable to lookup path %q: %w", templateKey, err)
+		return nil, fmt.Errorf("unable to lookup path %q: %w", path, err)
 	}
 
 	data, err := val.MarshalJSON()
 	if err != nil {
-		return nil, errors.Describe("unable to render JSON", err)
+		// MarshalJSON stops at the first error, validation will find all incomplete values
+		err = errors.Describe(desc, errors.CollectFrom(g.Value, g.cue.MaxErrors(), val.Validate(cue.Concrete(true)), err))
+		return nil, errors.Redact(err, g.sensitivePaths(g.Value))
+	}
+	if !g.sensitive || g.allowSensitive {
+		return data, nil
+	}
+	buf := &bytes.Buffer{}
+	if err := g.writeValue(val, buf, true); err != nil {
+		return nil, errors.Redact(errors.Describe(desc+": unable to redact sensitive values", err), g.sensitivePaths(g.Value))
 	}
-	return data, nil
+	return buf.Bytes(), nil
 }
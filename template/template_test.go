@@ -5,12 +5,23 @@
 package template_test
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"cuelang.org/go/cue"
 	. "github.com/onsi/gomega"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 
 	. "github.com/errordeveloper/cue-utils/template"
 	"github.com/errordeveloper/cue-utils/template/testtypes"
@@ -132,21 +143,68 @@ func TestGeneratorWithKubernetesResource(t *testing.T) {
 
 	{
 		pod := makePod()
-		// this case triggers buggy behaviour, because corev1.Pod doesn't cast to runtime.Object
-		_, err = gen.WithResource(*pod)
-		g.Expect(err).To(HaveOccurred())
-		// this looks like a bug in CUE, it
-		g.Expect(err.Error()).To(HavePrefix("unable to fill path \"resource\": resource.spec.volumes.0: field not allowed: bytes"))
-		// removing volumes from the pod spec makes it work
-		pod.Spec.Volumes = nil
-		_, err = gen.WithResource(*pod)
+		gen, err := gen.WithResource(*pod)
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		lookup := func(path string) string {
+			val := gen.Value.LookupPath(cue.ParsePath(path))
+			g.Expect(val.Err()).To(Not(HaveOccurred()))
+			js, err := val.MarshalJSON()
+			g.Expect(err).To(Not(HaveOccurred()))
+			return string(js)
+		}
+
+		g.Expect(lookup("resource.spec.volumes[1]")).To(MatchJSON(`{"name": "foo2", "emptyDir": {"medium": "Memory"}}`))
+		g.Expect(lookup("resource.spec.containers[0].resources.limits.cpu")).To(Equal(`"100m"`))
+		g.Expect(lookup("resource.spec.containers[0].readinessProbe.httpGet.port")).To(Equal(`"http"`))
+		g.Expect(lookup("resource.spec.containers[1].readinessProbe.tcpSocket.port")).To(Equal(`8080`))
+		g.Expect(lookup("resource.metadata.creationTimestamp")).To(Equal(`"2022-01-01T00:00:00Z"`))
+	}
+
+	{
+		_, err = gen.WithResource(unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Pod",
+			"spec":       map[string]interface{}{"volumes": []interface{}{map[string]interface{}{"name": "foo", "emptyDir": map[string]interface{}{}}}},
+		}})
+		g.Expect(err).To(Not(HaveOccurred()))
+	}
+
+	{
+		_, err = gen.WithResource(struct {
+			Spec corev1.PodSpec `json:"spec"`
+		}{Spec: makePod().Spec})
+		g.Expect(err).To(Not(HaveOccurred()))
+	}
+
+	{
+		gen, err := gen.WithResource(map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "foo"},
+			"spec":     makePod().Spec,
+		})
 		g.Expect(err).To(Not(HaveOccurred()))
+
+		val := gen.Value.LookupPath(cue.ParsePath("resource.spec.volumes[1]"))
+		g.Expect(val.Err()).To(Not(HaveOccurred()))
+		js, err := val.MarshalJSON()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(js).To(MatchJSON(`{"name": "foo2", "emptyDir": {"medium": "Memory"}}`))
 	}
 
+	{
+		gen, err := gen.WithInput("resource.spec.volumes", makePod().Spec.Volumes)
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		val := gen.Value.LookupPath(cue.ParsePath("resource.spec.volumes[1].emptyDir.medium"))
+		g.Expect(val.String()).To(Equal("Memory"))
+	}
 }
 
 func makePod() *corev1.Pod {
 	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			CreationTimestamp: metav1.NewTime(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)),
+		},
 		Spec: corev1.PodSpec{
 			Containers: []corev1.Container{
 				{
@@ -162,6 +220,16 @@ func makePod() *corev1.Pod {
 							Value: "/foo",
 						},
 					},
+					Resources: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{
+							corev1.ResourceCPU: resource.MustParse("100m"),
+						},
+					},
+					ReadinessProbe: &corev1.Probe{
+						ProbeHandler: corev1.ProbeHandler{
+							HTTPGet: &corev1.HTTPGetAction{Port: intstr.FromString("http")},
+						},
+					},
 				},
 				{
 					Name:  "sidecar",
@@ -170,6 +238,11 @@ func makePod() *corev1.Pod {
 						Name:      "foo1",
 						MountPath: "/foo",
 					}},
+					ReadinessProbe: &corev1.Probe{
+						ProbeHandler: corev1.ProbeHandler{
+							TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(8080)},
+						},
+					},
 				},
 			},
 			Volumes: []corev1.Volume{
@@ -269,3 +342,1770 @@ func TestGeneratorWithImportPath(t *testing.T) {
 	g.Expect(NewGenerator("./", "github.com/errordeveloper/cue-utils/template/testtypes").CompileAndValidate()).To(Succeed())
 	g.Expect(NewGenerator("./", "github.com/errordeveloper/cue-utils/template/testassets").CompileAndValidate()).To(Succeed())
 }
+
+func TestGeneratorWithResourceData(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	primaryGen := NewGenerator("./testassets")
+	g.Expect(primaryGen.CompileAndValidate()).To(Succeed())
+
+	{
+		gen, err := primaryGen.WithResourceData("cluster.yaml", []byte(`
+metadata:
+  name: foo1
+  namespace: default
+spec:
+  location: us-central1-a
+  subnetCIDR: 10.128.0.0/16
+`))
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		js, err := gen.RenderJSON()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(js).To(MatchJSON(expectedWithCIDR("10.128.0.0/16")))
+	}
+
+	{
+		_, err := primaryGen.WithResourceData("cluster.yaml", []byte(`
+metadata:
+  name: foo1
+  namespace: default
+spec:
+  location: 1
+  subnetCidr: 10.128.0.0/16
+`))
+		g.Expect(err).To(HaveOccurred())
+		// positions in the input document are reported next to positions in the template
+		g.Expect(err.Error()).To(MatchRegexp(`resource.spec.location: invalid interpolation: conflicting values string and 1 \(mismatched types string and int\):\n(    .*\.cue:\d+:\d+\n)+    cluster.yaml:6:14\n`))
+		g.Expect(err.Error()).To(MatchRegexp(`resource.spec: field not allowed: subnetCidr \(did you mean subnetCIDR\?\):\n(    .*\.cue:\d+:\d+\n)+    cluster.yaml:7:4\n`))
+	}
+
+	{
+		_, err := primaryGen.WithResourceData("cluster.json", []byte(`{
+  "metadata": {
+    "name": "foo1",
+    "namespace": 0
+  }
+}`))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(HavePrefix(`unable to fill path "resource": resource.metadata.namespace: invalid interpolation: conflicting values string and 0 (mismatched types string and int):`))
+		g.Expect(err.Error()).To(ContainSubstring("    cluster.json:4:18\n"))
+	}
+
+	{
+		_, err := primaryGen.WithResourceData("cluster.yaml", []byte("metadata: [\n"))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(HavePrefix(`failed to parse YAML (filename: "cluster.yaml"):`))
+	}
+}
+
+func TestGeneratorWithSlots(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	cluster := testtypes.Cluster{}
+	cluster.Metadata.Name = "foo1"
+	cluster.Metadata.Namespace = "default"
+	cluster.Spec.Location = "us-central1-a"
+
+	const expected = `{
+		"kind": "ConfigMap",
+		"apiVersion": "v1",
+		"metadata": {"namespace": "default", "name": "foo1"},
+		"data": {"location": "us-central1-a", "subnetCIDR": "10.128.0.0/20"}
+	}`
+
+	{
+		gen := New("./testassets/slots", WithSlots(Slots{
+			Template: "output",
+			Defaults: "params",
+			Resource: "input",
+		}))
+		g.Expect(gen.CompileAndValidate()).To(Succeed())
+		g.Expect(gen.Slots()).To(Equal(Slots{Template: "output", Outputs: "outputs", Defaults: "params", Resource: "input"}))
+
+		cidr := "10.128.0.0/20"
+		gen, err := gen.WithDefaults(&testtypes.Cluster{
+			Spec: testtypes.ClusterSpec{
+				SubnetCIDR: &cidr,
+			},
+		})
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(gen.Slots().Resource).To(Equal("input"))
+
+		gen, err = gen.WithResource(cluster)
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		js, err := gen.RenderJSON()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(js).To(MatchJSON(expected))
+
+		_, err = gen.WithResource(map[string]string{"foo": "bar"})
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(HavePrefix(`unable to fill path "input": input: field not allowed: foo:`))
+	}
+
+	{
+		gen := NewGenerator("./testassets/slots/declared")
+		g.Expect(gen.Slots()).To(Equal(Slots{Template: "template", Outputs: "outputs", Defaults: "defaults", Resource: "resource"}))
+		g.Expect(gen.CompileAndValidate()).To(Succeed())
+		g.Expect(gen.Slots()).To(Equal(Slots{Template: "output", Outputs: "outputs", Defaults: "params", Resource: "input"}))
+
+		gen, err := gen.WithResource(cluster)
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		js, err := gen.RenderJSON()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(js).To(MatchJSON(`{
+			"kind": "ConfigMap",
+			"apiVersion": "v1",
+			"metadata": {"namespace": "default", "name": "foo1"},
+			"data": {"location": "us-central1-a"}
+		}`))
+	}
+
+	{
+		// options take precedence over names declared in the package
+		gen := New("./testassets/slots/declared", WithSlots(Slots{Template: "input"}))
+		g.Expect(gen.CompileAndValidate()).To(Succeed())
+		g.Expect(gen.Slots()).To(Equal(Slots{Template: "input", Outputs: "outputs", Defaults: "params", Resource: "input"}))
+	}
+}
+
+func TestGeneratorWithInput(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	primaryGen := NewGenerator("./testassets/inputs")
+	g.Expect(primaryGen.CompileAndValidate()).To(Succeed())
+	g.Expect(primaryGen.Inputs()).To(Equal([]string{"defaults", "resource", "cluster", "environment", "featureFlags"}))
+
+	cluster := testtypes.Cluster{}
+	cluster.Metadata.Name = "foo1"
+	cluster.Metadata.Namespace = "default"
+
+	gen, err := primaryGen.WithResource(cluster)
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	gen, err = gen.WithInput("cluster", map[string]string{
+		"name":   "bar",
+		"region": "us-central1",
+	})
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	gen, err = gen.WithInput("environment", "prod")
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	gen, err = gen.WithInput("featureFlags.foo", true)
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	gen, err = gen.WithInput("featureFlags", map[string]bool{"bar": false})
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	js, err := gen.RenderJSON()
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(js).To(MatchJSON(`{
+		"kind": "ConfigMap",
+		"apiVersion": "v1",
+		"metadata": {
+			"namespace": "default",
+			"name": "foo1",
+			"labels": {"example.com/cluster": "bar", "example.com/environment": "prod"}
+		},
+		"data": {"region": "us-central1", "feature.foo": "enabled"}
+	}`))
+
+	{
+		_, err := gen.WithInput("template", map[string]string{})
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Equal(`"template" is not a declared input (inputs: [defaults resource cluster environment featureFlags])`))
+	}
+
+	{
+		_, err := gen.WithInput("clusterName", "bar")
+		g.Expect(err).To(HaveOccurred())
+	}
+
+	{
+		_, err := primaryGen.WithInput("environment", "test")
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(HavePrefix(`unable to fill path "environment": environment: conflicting values "dev" and "test":`))
+	}
+
+	{
+		gen := New("./testassets/inputs", WithInputs("extra"))
+		g.Expect(gen.CompileAndValidate()).To(Succeed())
+		g.Expect(gen.Inputs()).To(Equal([]string{"defaults", "resource", "cluster", "environment", "featureFlags", "extra"}))
+	}
+}
+
+func TestGeneratorMetadata(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	{
+		gen := NewGenerator("./testassets/metadata")
+		g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+		expected := Metadata{
+			DisplayName: "Cluster config",
+			Description: "Renders a ConfigMap with cluster location",
+			Owner:       "platform-team",
+			Version:     "1.2.0",
+			InputKind: metav1.TypeMeta{
+				APIVersion: "example.com/v1",
+				Kind:       "Cluster",
+			},
+			Tags: []string{"cluster", "gcp"},
+		}
+		g.Expect(gen.Metadata()).To(Equal(expected))
+
+		cluster := testtypes.Cluster{}
+		cluster.Metadata.Name = "foo1"
+		cluster.Metadata.Namespace = "default"
+		cluster.Spec.Location = "us-central1-a"
+
+		gen, err := gen.WithResource(cluster)
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(gen.Metadata()).To(Equal(expected))
+
+		js, err := gen.RenderJSON()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(string(js)).To(Not(ContainSubstring("platform-team")))
+	}
+
+	{
+		gen := NewGenerator("./testassets/lists")
+		g.Expect(gen.CompileAndValidate()).To(Succeed())
+		g.Expect(gen.Metadata()).To(Equal(Metadata{}))
+	}
+}
+
+func TestGeneratorGenerateCRD(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	gen := NewGenerator("./testassets/crd")
+	g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+	{
+		crd, err := gen.GenerateCRD(CRDOptions{
+			Group:   "example.com",
+			Version: "v1",
+			Kind:    "Widget",
+		})
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		js, err := crd.MarshalJSON()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(js).To(MatchJSON(`{
+			"apiVersion": "apiextensions.k8s.io/v1",
+			"kind": "CustomResourceDefinition",
+			"metadata": {"name": "widgets.example.com"},
+			"spec": {
+				"group": "example.com",
+				"names": {
+					"kind": "Widget",
+					"listKind": "WidgetList",
+					"plural": "widgets",
+					"singular": "widget"
+				},
+				"scope": "Namespaced",
+				"versions": [{
+					"name": "v1",
+					"served": true,
+					"storage": true,
+					"subresources": {"status": {}},
+					"schema": {"openAPIV3Schema": {
+						"type": "object",
+						"required": ["spec"],
+						"properties": {
+							"apiVersion": {"type": "string"},
+							"kind": {"type": "string"},
+							"metadata": {"type": "object"},
+							"spec": {
+								"type": "object",
+								"required": ["mode", "subnet", "replicas", "ports", "paused", "targetPort"],
+								"properties": {
+									"mode": {
+										"description": "Mode of operation",
+										"type": "string",
+										"enum": ["Standard", "Autopilot"],
+										"default": "Standard"
+									},
+									"subnet": {"type": "string", "pattern": "^10\\."},
+									"replicas": {
+										"type": "integer",
+										"minimum": 0,
+										"exclusiveMinimum": true,
+										"maximum": 10,
+										"default": 3
+									},
+									"ratio": {
+										"type": "number",
+										"minimum": 0.5,
+										"maximum": 1,
+										"exclusiveMaximum": true
+									},
+									"labels": {
+										"type": "object",
+										"additionalProperties": {"type": "string"}
+									},
+									"ports": {
+										"type": "array",
+										"items": {
+											"type": "object",
+											"required": ["name", "port"],
+											"properties": {
+												"name": {"type": "string"},
+												"port": {"type": "integer"}
+											}
+										}
+									},
+									"config": {"type": "object", "x-kubernetes-preserve-unknown-fields": true},
+									"paused": {"type": "boolean", "default": false},
+									"owner": {"type": "string", "nullable": true},
+									"targetPort": {"x-kubernetes-int-or-string": true}
+								}
+							},
+							"status": {
+								"type": "object",
+								"required": ["ready"],
+								"properties": {"ready": {"type": "boolean"}}
+							}
+						}
+					}}
+				}]
+			}
+		}`))
+	}
+
+	{
+		crd, err := gen.GenerateCRD(CRDOptions{
+			Group:   "example.com",
+			Version: "v1alpha1",
+			Kind:    "Widget",
+			Plural:  "widgetz",
+			Scope:   "Cluster",
+		})
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(crd.GetName()).To(Equal("widgetz.example.com"))
+		g.Expect(crd.Object["spec"]).To(HaveKeyWithValue("scope", "Cluster"))
+	}
+
+	{
+		_, err := gen.GenerateCRD(CRDOptions{Group: "example.com", Version: "v1", Kind: "Widget", Scope: "Global"})
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Equal(`invalid scope "Global", must be either Namespaced or Cluster`))
+	}
+
+	{
+		_, err := gen.GenerateCRD(CRDOptions{Group: "example.com"})
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Equal("group, version and kind must be set"))
+	}
+}
+
+func TestGeneratorPreview(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	gen := NewGenerator("./testassets")
+	g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+	gen, err := gen.WithResource(map[string]interface{}{
+		"metadata": map[string]string{"name": "foo1"},
+	})
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	_, err = gen.RenderJSON()
+	g.Expect(err).To(HaveOccurred())
+
+	js, err := gen.PreviewJSON()
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(string(js)).To(HavePrefix(`{"kind":"List","apiVersion":"v1","items":[{"apiVersion":"container.cnrm.cloud.google.com/v1beta1"`))
+
+	expected := strings.NewReplacer(
+		`"default"`, `"<missing: resource.metadata.namespace>"`,
+		`"us-central1-a"`, `"<missing: resource.spec.location>"`,
+	).Replace(expectedWithCIDR("<missing: defaults.spec.subnetCIDR, resource.spec.subnetCIDR>"))
+	g.Expect(js).To(MatchJSON(expected))
+
+	{
+		js, err := gen.Preview("template")
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(js).To(MatchJSON(expected))
+	}
+
+	{
+		_, err := gen.Preview("dashboards")
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Equal(`unknown output "dashboards" (outputs: [template])`))
+	}
+
+	{
+		cluster := testtypes.Cluster{}
+		cluster.Metadata.Name = "foo1"
+		cluster.Metadata.Namespace = "default"
+		cluster.Spec.Location = "us-central1-a"
+		cluster.Spec.SubnetCIDR = new(string)
+		*cluster.Spec.SubnetCIDR = "10.128.0.0/16"
+
+		gen, err := gen.WithResource(cluster)
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		preview, err := gen.PreviewJSON()
+		g.Expect(err).To(Not(HaveOccurred()))
+		rendered, err := gen.RenderJSON()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(preview).To(Equal(rendered))
+	}
+}
+
+func TestGeneratorProvenance(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	gen := New("./testassets/lists", WithProvenance())
+	g.Expect(gen.CompileAndValidate()).To(Succeed())
+	g.Expect(gen.TemplateDigest()).To(MatchRegexp(`^sha256:[0-9a-f]{64}$`))
+
+	render := func(name string) []unstructured.Unstructured {
+		gen, err := gen.WithResource(map[string]string{
+			"name":      name,
+			"namespace": "default",
+		})
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		objs, err := gen.RenderObjects()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(objs).To(HaveLen(3))
+
+		inputsDigest, err := gen.InputsDigest()
+		g.Expect(err).To(Not(HaveOccurred()))
+		for _, obj := range objs {
+			g.Expect(obj.GetAnnotations()).To(Equal(map[string]string{
+				TemplateAnnotation:       "github.com/errordeveloper/cue-utils/template/testassets/lists",
+				TemplateDigestAnnotation: gen.TemplateDigest(),
+				InputsDigestAnnotation:   inputsDigest,
+				VersionAnnotation:        Version(),
+			}))
+		}
+		return objs
+	}
+
+	foo := render("foo")
+	g.Expect(render("foo")[0].GetAnnotations()).To(Equal(foo[0].GetAnnotations()))
+	bar := render("bar")
+	g.Expect(bar[0].GetAnnotations()[InputsDigestAnnotation]).To(Not(Equal(foo[0].GetAnnotations()[InputsDigestAnnotation])))
+	g.Expect(bar[0].GetAnnotations()[TemplateDigestAnnotation]).To(Equal(foo[0].GetAnnotations()[TemplateDigestAnnotation]))
+
+	{
+		gen := NewGenerator("./testassets/lists")
+		g.Expect(gen.CompileAndValidate()).To(Succeed())
+		g.Expect(gen.TemplateDigest()).To(Equal(foo[0].GetAnnotations()[TemplateDigestAnnotation]))
+
+		gen, err := gen.WithResource(map[string]string{
+			"name":      "foo",
+			"namespace": "default",
+		})
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		objs, err := gen.RenderObjects()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(objs[0].GetAnnotations()).To(BeEmpty())
+	}
+
+	{
+		gen := NewGenerator("./testassets/ordering")
+		g.Expect(gen.CompileAndValidate()).To(Succeed())
+		g.Expect(gen.TemplateDigest()).To(Not(Equal(foo[0].GetAnnotations()[TemplateDigestAnnotation])))
+	}
+}
+
+func TestTypedGenerator(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	gen := NewGenerator("./testassets/metadata")
+	g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+	cluster := testtypes.Cluster{}
+	cluster.Metadata.Name = "foo1"
+	cluster.Metadata.Namespace = "default"
+	cluster.Spec.Location = "us-central1-a"
+
+	{
+		typed, err := NewTypedGenerator[testtypes.Cluster, corev1.ConfigMap](gen)
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(typed.Generator()).To(Equal(gen))
+
+		cm, err := typed.Render(context.Background(), cluster)
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(cm.Name).To(Equal("foo1"))
+		g.Expect(cm.Namespace).To(Equal("default"))
+		g.Expect(cm.Data).To(Equal(map[string]string{"location": "us-central1-a"}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = typed.Render(ctx, cluster)
+		g.Expect(err).To(MatchError(context.Canceled))
+	}
+
+	{
+		typed, err := NewTypedGenerator[*testtypes.Cluster, unstructured.Unstructured](gen)
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		obj, err := typed.Render(context.Background(), &cluster)
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(obj.GetKind()).To(Equal("ConfigMap"))
+	}
+
+	{
+		_, err := NewTypedGenerator[map[string]interface{}, corev1.ConfigMap](gen)
+		g.Expect(err).To(Not(HaveOccurred()))
+	}
+
+	{
+		_, err := NewTypedGenerator[int, corev1.ConfigMap](gen)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(HavePrefix(`type int doesn't match "resource": resource: conflicting values int and`))
+	}
+
+	{
+		type wrongCluster struct {
+			Metadata struct {
+				Name int `json:"name"`
+			} `json:"metadata"`
+			Extra string `json:"extra"`
+		}
+		_, err := NewTypedGenerator[wrongCluster, corev1.ConfigMap](gen)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("resource.metadata.name: conflicting values string and int (mismatched types string and int)"))
+		g.Expect(err.Error()).To(ContainSubstring("resource: field not allowed: extra"))
+	}
+
+	{
+		type partialCluster struct {
+			Metadata testtypes.ClusterMeta `json:"metadata"`
+		}
+		_, err := NewTypedGenerator[partialCluster, corev1.ConfigMap](gen)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Equal(`type template_test.partialCluster doesn't match "resource": required fields are missing: [spec]`))
+	}
+
+	{
+		gen := NewGenerator("./testassets/pods")
+		g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+		typed, err := NewTypedGenerator[corev1.Pod, corev1.Pod](gen)
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		pod := makePod()
+		pod.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"}
+		_, err = typed.Render(context.Background(), *pod)
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		_, err = NewTypedGenerator[*corev1.Pod, corev1.Pod](gen)
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		_, err = NewTypedGenerator[corev1.Service, corev1.Pod](gen)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("field not allowed"))
+	}
+}
+
+func TestGeneratorWithDefaultsLayers(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	gen := NewGenerator("./testassets/layers")
+	g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+	org := DefaultsLayer{Name: "org", Value: map[string]interface{}{
+		"region":   "us-central1",
+		"replicas": 2,
+		"labels":   map[string]string{"org": "acme"},
+		"zones":    []string{"a", "b"},
+	}}
+	team := DefaultsLayer{Name: "team", Value: map[string]interface{}{
+		"replicas": 3,
+		"labels":   map[string]string{"team": "a"},
+	}}
+	cluster := DefaultsLayer{Name: "cluster", Value: map[string]interface{}{
+		"region": "europe-west1",
+		"zones":  []string{"c"},
+	}}
+
+	{
+		gen, err := gen.WithDefaultsLayers(org, team, cluster)
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		g.Expect(gen.DefaultsSources()).To(Equal([]DefaultsSource{
+			{Path: "labels.org", Layer: "org"},
+			{Path: "labels.team", Layer: "team"},
+			{Path: "region", Layer: "cluster", Overrides: []string{"org"}},
+			{Path: "replicas", Layer: "team", Overrides: []string{"org"}},
+			{Path: "zones", Layer: "cluster", Overrides: []string{"org"}},
+		}))
+
+		gen, err = gen.WithResource(map[string]string{"name": "foo", "namespace": "default"})
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		js, err := gen.RenderJSON()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(js).To(MatchJSON(`{
+			"kind": "ConfigMap",
+			"apiVersion": "v1",
+			"metadata": {
+				"name": "foo",
+				"namespace": "default",
+				"labels": {"org": "acme", "team": "a"}
+			},
+			"data": {"region": "europe-west1", "replicas": "3"}
+		}`))
+
+		g.Expect(gen.Lineage()).To(HaveLen(2))
+		replayed, err := gen.Recompile()
+		g.Expect(err).To(Not(HaveOccurred()))
+		replayedJS, err := replayed.RenderJSON()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(replayedJS).To(MatchJSON(js))
+	}
+
+	{
+		environment := DefaultsLayer{Name: "environment", Value: map[string]interface{}{"tier": "gold"}}
+
+		_, err := gen.WithDefaultsLayers(org, environment, cluster)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(HavePrefix(`defaults layers "org" and "environment" conflict: unable to fill path "defaults": defaults.replicas: invalid value 2 (out of bound >=3)`))
+
+		_, err = gen.WithDefaultsLayers(org, team, environment, cluster)
+		g.Expect(err).To(Not(HaveOccurred()))
+	}
+
+	{
+		_, err := gen.WithDefaultsLayers(org, DefaultsLayer{Name: "team", Value: map[string]interface{}{"labels": "a"}})
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(HavePrefix(`defaults layer "team" is not valid: unable to fill path "defaults": defaults.labels: conflicting values "a" and {[string]:string}`))
+	}
+
+	{
+		_, err := gen.WithDefaultsLayers(
+			DefaultsLayer{Name: "org", Value: map[string]interface{}{"settings": map[string]int{"a": 1}}},
+			DefaultsLayer{Name: "team", Value: map[string]interface{}{"settings": "a=1"}},
+		)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Equal(`defaults layers "org" and "team" conflict at "settings": object cannot be merged with string`))
+	}
+
+	{
+		_, err := gen.WithDefaultsLayers(DefaultsLayer{Name: "org", Value: "us-central1"})
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(HavePrefix(`defaults layer "org" is not valid`))
+	}
+}
+
+func TestGeneratorRenderObjects(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	{
+		gen := NewGenerator("./testassets/lists")
+		g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+		gen, err := gen.WithResource(map[string]string{
+			"name":      "foo",
+			"namespace": "default",
+		})
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		objs, err := gen.RenderObjects()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(objs).To(HaveLen(3))
+
+		kinds := []string{}
+		for _, obj := range objs {
+			kinds = append(kinds, obj.GetKind())
+			g.Expect(obj.GetName()).To(Equal("foo"))
+			g.Expect(obj.GetNamespace()).To(Equal("default"))
+		}
+		g.Expect(kinds).To(Equal([]string{"ConfigMap", "Secret", "ServiceAccount"}))
+
+		scheme := runtime.NewScheme()
+		g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+		typedObjs, err := gen.RenderTypedObjects(scheme)
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(typedObjs).To(HaveLen(3))
+		g.Expect(typedObjs[0]).To(BeAssignableToTypeOf(&corev1.ConfigMap{}))
+		g.Expect(typedObjs[0].(*corev1.ConfigMap).Data).To(HaveKeyWithValue("foo", "bar"))
+		g.Expect(typedObjs[1]).To(BeAssignableToTypeOf(&corev1.Secret{}))
+		g.Expect(typedObjs[1].(*corev1.Secret).StringData).To(HaveKeyWithValue("foo", "bar"))
+		g.Expect(typedObjs[2]).To(BeAssignableToTypeOf(&corev1.ServiceAccount{}))
+		g.Expect(typedObjs[2].GetObjectKind().GroupVersionKind().Kind).To(Equal("ServiceAccount"))
+	}
+
+	{
+		gen := NewGenerator("./testassets")
+		g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+		cluster := testtypes.Cluster{}
+		cluster.Metadata.Name = "foo1"
+		cluster.Metadata.Namespace = "default"
+		cluster.Spec.Location = "us-central1-a"
+		cluster.Spec.SubnetCIDR = new(string)
+		*cluster.Spec.SubnetCIDR = "10.128.0.0/16"
+
+		gen, err := gen.WithResource(cluster)
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		objs, err := gen.RenderObjects()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(objs).To(HaveLen(3))
+		g.Expect(objs[2].GetKind()).To(Equal("ComputeSubnetwork"))
+
+		scheme := runtime.NewScheme()
+		g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+		_, err = gen.RenderTypedObjects(scheme)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Equal(`unable to convert object "foo1" (container.cnrm.cloud.google.com/v1beta1): kind "ContainerCluster" is not registered in the scheme`))
+	}
+
+	{
+		gen := NewGenerator("./testassets/pods")
+		g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+		_, err := gen.RenderObjects()
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Equal("template: not a Kubernetes object, apiVersion and kind must be set"))
+	}
+}
+
+func TestGeneratorObjectOrder(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	kinds := func(objs []unstructured.Unstructured) []string {
+		kinds := []string{}
+		for _, obj := range objs {
+			kinds = append(kinds, obj.GetKind())
+		}
+		return kinds
+	}
+
+	resource := map[string]string{
+		"name":      "foo",
+		"namespace": "default",
+	}
+
+	{
+		gen := NewGenerator("./testassets/ordering")
+		g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+		gen, err := gen.WithResource(resource)
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		objs, err := gen.RenderObjects()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(kinds(objs)).To(Equal([]string{
+			"Deployment",
+			"ComputeSubnetwork",
+			"ComputeNetwork",
+			"RoleBinding",
+			"ServiceAccount",
+			"CustomResourceDefinition",
+			"Namespace",
+		}))
+	}
+
+	{
+		gen := New("./testassets/ordering", WithObjectOrder())
+		g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+		gen, err := gen.WithResource(resource)
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		objs, err := gen.RenderObjects()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(kinds(objs)).To(Equal([]string{
+			"Namespace",
+			"CustomResourceDefinition",
+			"ServiceAccount",
+			"RoleBinding",
+			"Deployment",
+			"ComputeNetwork",
+			"ComputeSubnetwork",
+		}))
+
+		gen, err = gen.Recompile()
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		objs, err = gen.RenderObjects()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(kinds(objs)[0]).To(Equal("Namespace"))
+	}
+
+	{
+		gen := New("./testassets/ordering", WithObjectOrder("ComputeSubnetwork", "Namespace"))
+		g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+		gen, err := gen.WithResource(resource)
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		objs, err := gen.RenderObjects()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(kinds(objs)).To(Equal([]string{
+			"Namespace",
+			"Deployment",
+			"ComputeNetwork",
+			"ComputeSubnetwork",
+			"RoleBinding",
+			"ServiceAccount",
+			"CustomResourceDefinition",
+		}))
+	}
+
+	newObject := func(kind, name, dependsOn string) unstructured.Unstructured {
+		obj := unstructured.Unstructured{}
+		obj.SetAPIVersion("example.com/v1")
+		obj.SetKind(kind)
+		obj.SetNamespace("default")
+		obj.SetName(name)
+		if dependsOn != "" {
+			obj.SetAnnotations(map[string]string{DependsOnAnnotation: dependsOn})
+		}
+		return obj
+	}
+
+	{
+		objs := []unstructured.Unstructured{
+			newObject("Widget", "a", "example.com/namespaces/default/Widget/b"),
+			newObject("Widget", "b", "example.com/namespaces/default/Widget/c, /namespaces/default/ConfigMap/missing"),
+			newObject("Widget", "c", "example.com/namespaces/default/Widget/b"),
+		}
+		_, err := SortObjects(objs)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Equal("dependency cycle between objects: " +
+			"example.com/namespaces/default/Widget/b -> " +
+			"example.com/namespaces/default/Widget/c -> " +
+			"example.com/namespaces/default/Widget/b"))
+	}
+
+	{
+		objs := []unstructured.Unstructured{
+			newObject("Widget", "a", "example.com/Widget"),
+		}
+		_, err := SortObjects(objs)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Equal(`invalid "config.kubernetes.io/depends-on" annotation on object example.com/namespaces/default/Widget/a: unexpected reference "example.com/Widget"`))
+	}
+}
+
+func TestGeneratorTransformers(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	resource := map[string]string{
+		"name":      "foo",
+		"namespace": "default",
+		"image":     "docker.io/example/foo:v1",
+	}
+
+	owner := metav1.OwnerReference{
+		APIVersion: "example.com/v1",
+		Kind:       "App",
+		Name:       "foo",
+		UID:        "c0ffee",
+	}
+
+	{
+		gen := New("./testassets/transformers", WithTransformers(
+			SetLabels(map[string]string{"team": "a", "tier": "frontend"}),
+			SetAnnotations(map[string]string{"example.com/note": "transformed"}),
+			SetNamespace("staging"),
+			AddOwnerReference(owner),
+			AddOwnerReference(owner),
+			RewriteImageRegistry("docker.io/", "mirror.example.com"),
+		))
+		g.Expect(gen.CompileAndValidate()).To(Succeed())
+		g.Expect(gen.Configure(WithTransformers(SetLabels(map[string]string{"tier": "backend"})))).To(Succeed())
+
+		gen, err := gen.WithResource(resource)
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		objs, err := gen.RenderObjects()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(objs).To(HaveLen(3))
+
+		g.Expect(objs[0].GetNamespace()).To(BeEmpty())
+		g.Expect(objs[0].GetLabels()).To(Equal(map[string]string{"team": "a", "tier": "backend"}))
+
+		for _, obj := range objs[1:] {
+			g.Expect(obj.GetNamespace()).To(Equal("staging"))
+			g.Expect(obj.GetLabels()).To(Equal(map[string]string{"app": "foo", "team": "a", "tier": "backend"}))
+			g.Expect(obj.GetAnnotations()).To(HaveKeyWithValue("example.com/note", "transformed"))
+			g.Expect(obj.GetOwnerReferences()).To(Equal([]metav1.OwnerReference{owner}))
+		}
+
+		images := func(obj unstructured.Unstructured, path ...string) []string {
+			images := []string{}
+			for _, field := range []string{"initContainers", "containers"} {
+				containers, _, err := unstructured.NestedSlice(obj.Object, append(path, field)...)
+				g.Expect(err).To(Not(HaveOccurred()))
+				for _, container := range containers {
+					images = append(images, container.(map[string]interface{})["image"].(string))
+				}
+			}
+			return images
+		}
+		expectedImages := []string{
+			"mirror.example.com/library/busybox:1.35",
+			"mirror.example.com/example/foo:v1",
+		}
+		g.Expect(images(objs[1], "spec", "template", "spec")).To(Equal(expectedImages))
+		g.Expect(images(objs[2], "spec", "jobTemplate", "spec", "template", "spec")).To(Equal(expectedImages))
+
+		js, err := gen.RenderJSON()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(string(js)).To(ContainSubstring(`"image":"docker.io/example/foo:v1"`))
+		g.Expect(string(js)).To(Not(ContainSubstring("staging")))
+
+		gen, err = gen.Recompile()
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		objs, err = gen.RenderObjects()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(objs[1].GetNamespace()).To(Equal("staging"))
+	}
+
+	{
+		failing := TransformerFunc(func(objs []unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+			return nil, fmt.Errorf("%d objects are too many", len(objs))
+		})
+		gen := New("./testassets/transformers", WithTransformers(SetNamespace("staging"), failing))
+		g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+		gen, err := gen.WithResource(resource)
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		_, err = gen.RenderObjects()
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Equal("transformer 1 (template.TransformerFunc) failed: 3 objects are too many"))
+	}
+
+	{
+		object := func(kind, namespace string) unstructured.Unstructured {
+			obj := unstructured.Unstructured{}
+			obj.SetAPIVersion("v1")
+			obj.SetKind(kind)
+			obj.SetName("foo")
+			obj.SetNamespace(namespace)
+			return obj
+		}
+		namespaces := func(objs []unstructured.Unstructured) []string {
+			namespaces := []string{}
+			for _, obj := range objs {
+				namespaces = append(namespaces, obj.GetNamespace())
+			}
+			return namespaces
+		}
+
+		objs, err := SetNamespace("staging").Transform([]unstructured.Unstructured{
+			object("ConfigMap", ""),
+			object("Secret", "default"),
+			object("ClusterRole", ""),
+			object("Widget", ""),
+		})
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(namespaces(objs)).To(Equal([]string{"staging", "staging", "", "staging"}))
+
+		objs, err = SetNamespace("staging", append(DefaultClusterScopedKinds, "Widget")...).Transform([]unstructured.Unstructured{
+			object("ConfigMap", ""),
+			object("ClusterRole", ""),
+			object("Widget", ""),
+		})
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(namespaces(objs)).To(Equal([]string{"staging", "", ""}))
+	}
+}
+
+func TestGeneratorContentHashSuffix(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	gen := New("./testassets/hashes", WithTransformers(ContentHashSuffix()))
+	g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+	render := func(config map[string]string) []unstructured.Unstructured {
+		gen, err := gen.WithResource(map[string]interface{}{
+			"name":      "foo",
+			"namespace": "default",
+			"config":    config,
+		})
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		objs, err := gen.RenderObjects()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(objs).To(HaveLen(3))
+		return objs
+	}
+
+	objs := render(map[string]string{"foo": "bar"})
+
+	configName := objs[0].GetName()
+	secretName := objs[1].GetName()
+	g.Expect(configName).To(MatchRegexp(`^foo-config-[0-9a-z]{10}$`))
+	g.Expect(secretName).To(MatchRegexp(`^foo-credentials-[0-9a-z]{10}$`))
+	g.Expect(objs[2].GetName()).To(Equal("foo"))
+
+	spec, _, err := unstructured.NestedMap(objs[2].Object, "spec", "template", "spec")
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	container := spec["containers"].([]interface{})[0].(map[string]interface{})
+	g.Expect(container["envFrom"]).To(Equal([]interface{}{
+		map[string]interface{}{"configMapRef": map[string]interface{}{"name": configName}},
+		map[string]interface{}{"configMapRef": map[string]interface{}{"name": "external"}},
+	}))
+	g.Expect(container["env"].([]interface{})[0]).To(HaveKeyWithValue("valueFrom", map[string]interface{}{
+		"secretKeyRef": map[string]interface{}{"name": secretName, "key": "password"},
+	}))
+	volumes := spec["volumes"].([]interface{})
+	g.Expect(volumes[0]).To(HaveKeyWithValue("configMap", map[string]interface{}{"name": configName}))
+	g.Expect(volumes[1]).To(HaveKeyWithValue("secret", map[string]interface{}{"secretName": secretName}))
+	g.Expect(volumes[2]).To(HaveKeyWithValue("projected", map[string]interface{}{
+		"sources": []interface{}{
+			map[string]interface{}{"configMap": map[string]interface{}{"name": configName}},
+			map[string]interface{}{"secret": map[string]interface{}{"name": secretName}},
+		},
+	}))
+
+	{
+		objs := render(map[string]string{"foo": "bar"})
+		g.Expect(objs[0].GetName()).To(Equal(configName))
+		g.Expect(objs[1].GetName()).To(Equal(secretName))
+	}
+
+	{
+		objs := render(map[string]string{"foo": "baz"})
+		g.Expect(objs[0].GetName()).To(Not(Equal(configName)))
+		g.Expect(objs[1].GetName()).To(Equal(secretName))
+	}
+
+	{
+		configMap := unstructured.Unstructured{}
+		configMap.SetAPIVersion("v1")
+		configMap.SetKind("ConfigMap")
+		configMap.SetNamespace("a")
+		configMap.SetName("config")
+
+		pod := unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"containers": []interface{}{map[string]interface{}{
+					"name":    "app",
+					"envFrom": []interface{}{map[string]interface{}{"configMapRef": map[string]interface{}{"name": "config"}}},
+				}},
+			},
+		}}
+		pod.SetAPIVersion("v1")
+		pod.SetKind("Pod")
+		pod.SetNamespace("b")
+		pod.SetName("app")
+
+		objs, err := ContentHashSuffix().Transform([]unstructured.Unstructured{configMap, pod})
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(objs[0].GetName()).To(HavePrefix("config-"))
+		containers, _, err := unstructured.NestedSlice(objs[1].Object, "spec", "containers")
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(containers[0]).To(HaveKeyWithValue("envFrom", []interface{}{
+			map[string]interface{}{"configMapRef": map[string]interface{}{"name": "config"}},
+		}))
+	}
+}
+
+func TestGeneratorRenderBatch(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	gen := New("./testassets/lists", WithBatchWorkers(4))
+	g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+	inputs := []interface{}{}
+	for i := 0; i < 20; i++ {
+		inputs = append(inputs, map[string]string{
+			"name":      fmt.Sprintf("foo%d", i),
+			"namespace": "default",
+		})
+	}
+	inputs[7] = map[string]interface{}{"name": 7}
+
+	{
+		results, err := gen.RenderBatch(context.Background(), inputs)
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(results).To(HaveLen(len(inputs)))
+
+		for i, result := range results {
+			if i == 7 {
+				g.Expect(result.Err).To(HaveOccurred())
+				g.Expect(result.Err.Error()).To(HavePrefix(`unable to fill path "resource": resource.name: conflicting values string and 7 (mismatched types string and int)`))
+				g.Expect(result.Objects).To(BeNil())
+				continue
+			}
+			g.Expect(result.Err).To(Not(HaveOccurred()))
+			g.Expect(result.Objects).To(HaveLen(3))
+			for _, obj := range result.Objects {
+				g.Expect(obj.GetName()).To(Equal(fmt.Sprintf("foo%d", i)))
+			}
+		}
+	}
+
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		results, err := gen.RenderBatch(ctx, inputs)
+		g.Expect(err).To(MatchError(context.Canceled))
+		g.Expect(results).To(HaveLen(len(inputs)))
+		for _, result := range results {
+			g.Expect(result.Err).To(MatchError(context.Canceled))
+		}
+	}
+
+	{
+		results, err := gen.RenderBatch(context.Background(), nil)
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(results).To(BeEmpty())
+	}
+}
+
+// BenchmarkRenderBatch shows how throughput scales with the number of workers,
+// since CUE operations are serialised by the shared compiler lock, only the
+// transformers and parsing of rendered objects benefit from more workers
+func BenchmarkRenderBatch(b *testing.B) {
+	gen := New("./testassets/transformers", WithTransformers(
+		SetLabels(map[string]string{"team": "a"}),
+		RewriteImageRegistry("docker.io", "mirror.example.com"),
+		ContentHashSuffix(),
+	))
+	if err := gen.CompileAndValidate(); err != nil {
+		b.Fatal(err)
+	}
+
+	newInputs := func(n int) []interface{} {
+		inputs := make([]interface{}, n)
+		for i := range inputs {
+			inputs[i] = map[string]string{
+				"name":      fmt.Sprintf("foo%d", i),
+				"namespace": "default",
+				"image":     "docker.io/example/foo:v1",
+			}
+		}
+		return inputs
+	}
+
+	b.Run("sequential", func(b *testing.B) {
+		inputs := newInputs(b.N)
+		b.ResetTimer()
+		for i := range inputs {
+			gen, err := gen.WithResource(inputs[i])
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := gen.RenderObjects(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			if err := gen.Configure(WithBatchWorkers(workers)); err != nil {
+				b.Fatal(err)
+			}
+			inputs := newInputs(b.N)
+			b.ResetTimer()
+			results, err := gen.RenderBatch(context.Background(), inputs)
+			if err != nil {
+				b.Fatal(err)
+			}
+			for _, result := range results {
+				if result.Err != nil {
+					b.Fatal(result.Err)
+				}
+			}
+		})
+	}
+}
+
+func TestGeneratorRenderToDirectory(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	base := NewGenerator("./testassets/lists")
+	g.Expect(base.CompileAndValidate()).To(Succeed())
+
+	withName := func(name string) *Generator {
+		gen, err := base.WithResource(map[string]string{
+			"name":      name,
+			"namespace": "default",
+		})
+		g.Expect(err).To(Not(HaveOccurred()))
+		return gen
+	}
+
+	dir := t.TempDir()
+	g.Expect(os.WriteFile(filepath.Join(dir, "README.md"), []byte("not generated\n"), 0o644)).To(Succeed())
+
+	{
+		result, err := withName("foo").RenderToDirectory(dir, DirectoryOptions{})
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(result.Added).To(Equal([]string{
+			"default/configmap-foo.yaml",
+			"default/secret-foo.yaml",
+			"default/serviceaccount-foo.yaml",
+		}))
+		g.Expect(result.Changed).To(BeEmpty())
+		g.Expect(result.Removed).To(BeEmpty())
+
+		data, err := os.ReadFile(filepath.Join(dir, "default", "configmap-foo.yaml"))
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(string(data)).To(Equal(fmt.Sprintf(`# Code generated by cue-utils from %s; DO NOT EDIT.
+apiVersion: v1
+data:
+  foo: bar
+kind: ConfigMap
+metadata:
+  name: foo
+  namespace: default
+`, base.ImportPath)))
+	}
+
+	{
+		result, err := withName("foo").RenderToDirectory(dir, DirectoryOptions{})
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(result.Added).To(BeEmpty())
+		g.Expect(result.Changed).To(BeEmpty())
+		g.Expect(result.Removed).To(BeEmpty())
+		g.Expect(result.Unchanged).To(HaveLen(3))
+	}
+
+	{
+		path := filepath.Join(dir, "default", "secret-foo.yaml")
+		data, err := os.ReadFile(path)
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(os.WriteFile(path, append(data, "# local edit\n"...), 0o644)).To(Succeed())
+
+		result, err := withName("foo").RenderToDirectory(dir, DirectoryOptions{})
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(result.Changed).To(Equal([]string{"default/secret-foo.yaml"}))
+	}
+
+	{
+		result, err := withName("bar").RenderToDirectory(dir, DirectoryOptions{Naming: "<namespace>/<kind>/<name>.yaml"})
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(result.Added).To(Equal([]string{
+			"default/configmap/bar.yaml",
+			"default/secret/bar.yaml",
+			"default/serviceaccount/bar.yaml",
+		}))
+		g.Expect(result.Removed).To(Equal([]string{
+			"default/configmap-foo.yaml",
+			"default/secret-foo.yaml",
+			"default/serviceaccount-foo.yaml",
+		}))
+		g.Expect(filepath.Join(dir, "README.md")).To(BeAnExistingFile())
+	}
+
+	{
+		result, err := withName("baz").RenderToDirectory(dir, DirectoryOptions{Owner: "other"})
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(result.Added).To(HaveLen(3))
+		g.Expect(result.Removed).To(BeEmpty())
+		g.Expect(filepath.Join(dir, "default", "configmap", "bar.yaml")).To(BeAnExistingFile())
+	}
+
+	{
+		g.Expect(os.WriteFile(filepath.Join(dir, "default", "configmap-qux.yaml"), []byte("kind: ConfigMap\n"), 0o644)).To(Succeed())
+
+		_, err := withName("qux").RenderToDirectory(dir, DirectoryOptions{})
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(HavePrefix("refusing to overwrite"))
+		g.Expect(err.Error()).To(HaveSuffix("configmap-qux.yaml\", as it is not owned by " + base.ImportPath))
+		g.Expect(filepath.Join(dir, "default", "secret-qux.yaml")).To(Not(BeAnExistingFile()))
+	}
+
+	{
+		_, err := withName("foo").RenderToDirectory(dir, DirectoryOptions{Naming: "<namespace>.yaml"})
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Equal(`more than one object would be written to "default.yaml"`))
+	}
+
+	{
+		// directories left empty are removed, even when dir is not clean
+		wd, err := os.Getwd()
+		g.Expect(err).To(Not(HaveOccurred()))
+		rel, err := filepath.Rel(wd, t.TempDir())
+		g.Expect(err).To(Not(HaveOccurred()))
+		dir := "./" + rel + "/"
+
+		options := DirectoryOptions{Naming: "<namespace>/<kind>/<name>.yaml"}
+		_, err = withName("foo").RenderToDirectory(dir, options)
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		result, err := withName("bar").RenderToDirectory(dir, DirectoryOptions{})
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(result.Removed).To(HaveLen(3))
+		g.Expect(filepath.Join(dir, "default", "configmap")).To(Not(BeAnExistingFile()))
+		g.Expect(filepath.Join(dir, "default", "secret")).To(Not(BeAnExistingFile()))
+		g.Expect(filepath.Join(dir, "default", "serviceaccount")).To(Not(BeAnExistingFile()))
+		g.Expect(filepath.Join(dir, "default", "configmap-bar.yaml")).To(BeAnExistingFile())
+	}
+}
+
+func TestGeneratorRenderOutputs(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	{
+		primaryGen := NewGenerator("./testassets/outputs")
+		g.Expect(primaryGen.CompileAndValidate()).To(Succeed())
+
+		outputs, err := primaryGen.Outputs()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(outputs).To(Equal([]string{"manifests", "dashboards", "alerts"}))
+
+		_, err = primaryGen.Render("alerts")
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(HavePrefix(`unable to render output "alerts": outputs.alerts.groups.0.name: incomplete value string:`))
+
+		gen, err := primaryGen.WithResource(map[string]string{
+			"name":      "foo",
+			"namespace": "default",
+		})
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		js, err := gen.Render("dashboards")
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(js).To(MatchJSON(`{"foo.json": {"title": "foo overview", "panels": []}}`))
+
+		_, err = gen.Render("template")
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Equal(`unknown output "template" (outputs: [manifests dashboards alerts])`))
+
+		rendered, err := gen.RenderAll()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(rendered).To(HaveLen(3))
+		g.Expect(rendered).To(HaveKey("manifests"))
+		g.Expect(rendered["dashboards"]).To(MatchJSON(js))
+		g.Expect(rendered["alerts"]).To(MatchJSON(`{
+			"groups": [{
+				"name": "foo",
+				"rules": [{"alert": "fooDown", "expr": "up{job=\"foo\"} == 0"}]
+			}]
+		}`))
+	}
+
+	{
+		// a template without named outputs has a single output
+		gen := NewGenerator("./testassets/lists")
+		g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+		outputs, err := gen.Outputs()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(outputs).To(Equal([]string{"template"}))
+
+		gen, err = gen.WithResource(map[string]string{
+			"name":      "foo",
+			"namespace": "default",
+		})
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		js, err := gen.RenderJSON()
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		rendered, err := gen.RenderAll()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(rendered).To(HaveLen(1))
+		g.Expect(rendered["template"]).To(MatchJSON(js))
+	}
+}
+
+func TestGeneratorRenderObjectsFor(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	{
+		primaryGen := New("./testassets/outputs", WithProvenance(),
+			WithTransformers(SetLabels(map[string]string{"tier": "backend"})))
+		g.Expect(primaryGen.CompileAndValidate()).To(Succeed())
+
+		gen, err := primaryGen.WithResource(map[string]string{
+			"name":      "foo",
+			"namespace": "default",
+		})
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		_, err = gen.RenderObjects()
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Equal(`package doesn't define "template", it only declares named outputs [manifests dashboards alerts], use Render or RenderObjectsFor instead`))
+
+		objs, err := gen.RenderObjectsFor("manifests")
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(objs).To(HaveLen(1))
+		g.Expect(objs[0].GetKind()).To(Equal("Deployment"))
+		g.Expect(objs[0].GetLabels()).To(HaveKeyWithValue("tier", "backend"))
+		g.Expect(objs[0].GetAnnotations()).To(HaveKey(TemplateAnnotation))
+
+		_, err = gen.RenderObjectsFor("dashboards")
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Equal(`outputs.dashboards: not a Kubernetes object, apiVersion and kind must be set`))
+
+		_, err = gen.RenderObjectsFor("template")
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Equal(`unknown output "template" (outputs: [manifests dashboards alerts])`))
+	}
+
+	{
+		primaryGen := New("./testassets/outputs", WithObjectsOutput("manifests"), WithObjectOrder())
+		g.Expect(primaryGen.CompileAndValidate()).To(Succeed())
+
+		gen, err := primaryGen.WithResource(map[string]string{
+			"name":      "foo",
+			"namespace": "default",
+		})
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		objs, err := gen.RenderObjects()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(objs).To(HaveLen(1))
+		g.Expect(objs[0].GetName()).To(Equal("foo"))
+
+		typedGen, err := NewTypedGenerator[map[string]string, map[string]interface{}](primaryGen)
+		g.Expect(err).To(Not(HaveOccurred()))
+		out, err := typedGen.Render(context.Background(), map[string]string{
+			"name":      "foo",
+			"namespace": "default",
+		})
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(out).To(HaveKeyWithValue("kind", "List"))
+	}
+}
+
+func TestGeneratorLineage(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	primaryGen := NewGenerator("./", "github.com/errordeveloper/cue-utils/template/testassets")
+	g.Expect(primaryGen.CompileAndValidate()).To(Succeed())
+	g.Expect(primaryGen.Lineage()).To(BeEmpty())
+
+	cidr := "10.128.0.0/20"
+	defaults := &testtypes.Cluster{
+		Spec: testtypes.ClusterSpec{
+			SubnetCIDR: &cidr,
+		},
+	}
+	baseGen, err := primaryGen.WithDefaults(defaults)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(baseGen.ImportPath).To(Equal("github.com/errordeveloper/cue-utils/template/testassets"))
+
+	gen, err := baseGen.WithResourceData("cluster.yaml", []byte(`
+metadata:
+  name: foo1
+  namespace: default
+spec:
+  location: us-central1-a
+`))
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(gen.ImportPath).To(Equal(primaryGen.ImportPath))
+	g.Expect(gen.Lineage()).To(Equal([]Input{
+		{Path: "defaults", Value: defaults},
+		{Path: "resource", Filename: "cluster.yaml", Data: gen.Lineage()[1].Data},
+	}))
+	// lineage of the base generator is not affected
+	g.Expect(baseGen.Lineage()).To(HaveLen(1))
+
+	expected, err := gen.RenderJSON()
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(expected).To(MatchJSON(expectedWithCIDR("10.128.0.0/20")))
+
+	{
+		recompiledGen, err := gen.Recompile()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(recompiledGen.Compiler()).ToNot(BeIdenticalTo(gen.Compiler()))
+		g.Expect(recompiledGen.ImportPath).To(Equal(gen.ImportPath))
+		g.Expect(recompiledGen.Lineage()).To(Equal(gen.Lineage()))
+
+		js, err := recompiledGen.RenderJSON()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(js).To(MatchJSON(expected))
+	}
+
+	{
+		freshGen := NewGenerator("./testassets")
+		g.Expect(freshGen.CompileAndValidate()).To(Succeed())
+
+		replayedGen, err := freshGen.Replay(gen.Lineage())
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		js, err := replayedGen.RenderJSON()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(js).To(MatchJSON(expected))
+
+		_, err = freshGen.Replay([]Input{{Path: "resource", Value: 0}})
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(HavePrefix(`unable to replay input 0 (path: "resource"): unable to fill path "resource":`))
+	}
+}
+
+func TestGeneratorCheck(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	primaryGen := NewGenerator("./testassets")
+	g.Expect(primaryGen.CompileAndValidate()).To(Succeed())
+
+	fields, err := primaryGen.Check()
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(fields).To(HaveLen(14))
+	g.Expect(fields[0]).To(Equal(IncompleteField{
+		Path:      "template.items[0].metadata.namespace",
+		Value:     `"\(resource.metadata.namespace)"`,
+		DependsOn: []string{"resource.metadata.namespace"},
+	}))
+	g.Expect(fields[12]).To(Equal(IncompleteField{
+		Path:      "template.items[2].spec.ipCidrRange",
+		Value:     `"\(variables.subnetCIDR)"`,
+		DependsOn: []string{"defaults.spec.subnetCIDR", "resource.spec.subnetCIDR"},
+	}))
+
+	gen, err := primaryGen.WithResource(map[string]interface{}{
+		"metadata": map[string]string{"name": "foo1"},
+	})
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	fields, err = gen.Check()
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	paths := []string{}
+	dependsOn := map[string]struct{}{}
+	for _, field := range fields {
+		paths = append(paths, field.Path)
+		for _, input := range field.DependsOn {
+			dependsOn[input] = struct{}{}
+		}
+	}
+	g.Expect(paths).To(Equal([]string{
+		"template.items[0].metadata.namespace",
+		"template.items[0].spec.location",
+		"template.items[1].metadata.namespace",
+		"template.items[2].metadata.namespace",
+		"template.items[2].spec.ipCidrRange",
+	}))
+	g.Expect(dependsOn).To(HaveLen(4))
+	g.Expect(dependsOn).To(HaveKey("resource.metadata.namespace"))
+	g.Expect(dependsOn).To(HaveKey("resource.spec.location"))
+	g.Expect(dependsOn).To(HaveKey("resource.spec.subnetCIDR"))
+	g.Expect(dependsOn).To(HaveKey("defaults.spec.subnetCIDR"))
+
+	cluster := testtypes.Cluster{}
+	cluster.Metadata.Name = "foo1"
+	cluster.Metadata.Namespace = "default"
+	cluster.Spec.Location = "us-central1-a"
+	cluster.Spec.SubnetCIDR = new(string)
+	*cluster.Spec.SubnetCIDR = "10.128.0.0/16"
+
+	gen, err = primaryGen.WithResource(cluster)
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	fields, err = gen.Check()
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(fields).To(BeEmpty())
+
+	{
+		gen := NewGenerator("./testassets/inputs")
+		g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+		fields, err := gen.Check()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(fields).To(ContainElement(IncompleteField{
+			Path:      `template.metadata.labels."example.com/environment"`,
+			Value:     `"dev" | "staging" | "prod"`,
+			DependsOn: []string{"environment"},
+		}))
+	}
+}
+
+func TestGeneratorSensitive(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	resource := func(password string) map[string]interface{} {
+		return map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "db"},
+			"spec": map[string]interface{}{
+				"username": "admin",
+				"password": password,
+			},
+		}
+	}
+
+	gen := NewGenerator("./testassets/sensitive")
+	g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+	{
+		gen, err := gen.WithResource(resource("s3cr3t-pass"))
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		data, err := gen.RenderJSON()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(string(data)).To(Not(ContainSubstring("s3cr3t-pass")))
+
+		objs, err := gen.RenderObjects()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(objs[0].Object["stringData"]).To(Equal(map[string]interface{}{
+			"username": "admin",
+			"password": "<redacted>",
+			"url":      "<redacted>",
+		}))
+
+		preview, err := gen.PreviewJSON()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(string(preview)).To(Not(ContainSubstring("s3cr3t-pass")))
+
+		dump, err := gen.Dump()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(dump).To(Not(ContainSubstring("s3cr3t-pass")))
+		g.Expect(dump).To(ContainSubstring(`password: "<redacted>"`))
+		g.Expect(fmt.Sprint(gen.Value)).To(ContainSubstring("s3cr3t-pass"))
+
+		g.Expect(gen.Redact(nil)).To(BeNil())
+		plainErr := fmt.Errorf("connecting as admin")
+		g.Expect(gen.Redact(plainErr)).To(BeIdenticalTo(plainErr))
+	}
+
+	{
+		// only the sensitive field and values derived from it are redacted,
+		// other fields with the same value are left as they are
+		gen, err := gen.WithResource(map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "database"},
+			"spec": map[string]interface{}{
+				"username": "database",
+				"password": "database",
+			},
+		})
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		objs, err := gen.RenderObjects()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(objs[0].GetName()).To(Equal("database"))
+		g.Expect(objs[0].GetLabels()).To(Equal(map[string]string{"app": "database-app"}))
+		g.Expect(objs[0].Object["stringData"]).To(Equal(map[string]interface{}{
+			"username": "database",
+			"password": "<redacted>",
+			"url":      "<redacted>",
+		}))
+	}
+
+	{
+		gen, err := gen.WithResource(map[string]interface{}{
+			"spec": map[string]interface{}{"password": "s3cr3t-pass"},
+		})
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		_, err = gen.RenderJSON()
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("incomplete value string"))
+		g.Expect(err.Error()).To(Not(ContainSubstring("s3cr3t-pass")))
+	}
+
+	{
+		_, err := gen.WithResource(resource("short"))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring(`resource.spec.password: invalid value <redacted>`))
+		g.Expect(err.Error()).To(Not(ContainSubstring("short")))
+	}
+
+	{
+		// inputs are redacted in the lineage, and sensitive values don't
+		// affect the inputs digest
+		primaryGen := gen
+		gen, err := primaryGen.WithResource(resource("s3cr3t-pass"))
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		lineage := gen.Lineage()
+		g.Expect(lineage).To(HaveLen(1))
+		g.Expect(lineage[0].Value).To(Equal(map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "db"},
+			"spec": map[string]interface{}{
+				"username": "admin",
+				"password": "<redacted>",
+			},
+		}))
+		g.Expect(resource("s3cr3t-pass")["spec"]).To(HaveKeyWithValue("password", "s3cr3t-pass"))
+
+		otherGen, err := gen.WithResourceData("db.yaml", []byte("metadata:\n  name: db\nspec:\n  username: admin\n  password: 0ther-s3cr3t\n"))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Not(ContainSubstring("s3cr3t")))
+
+		otherGen, err = primaryGen.WithResourceData("db.yaml", []byte("metadata:\n  name: db\nspec:\n  username: admin\n  password: 0ther-s3cr3t\n"))
+		g.Expect(err).To(Not(HaveOccurred()))
+		lineage = otherGen.Lineage()
+		g.Expect(lineage).To(HaveLen(1))
+		g.Expect(lineage[0].Filename).To(Equal("db.yaml"))
+		g.Expect(lineage[0].Data).To(BeNil())
+		g.Expect(lineage[0].Value).To(Equal(map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "db"},
+			"spec": map[string]interface{}{
+				"username": "admin",
+				"password": "<redacted>",
+			},
+		}))
+
+		digest, err := gen.InputsDigest()
+		g.Expect(err).To(Not(HaveOccurred()))
+		otherGen, err = primaryGen.WithResource(resource("0ther-s3cr3t"))
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(otherGen.InputsDigest()).To(Equal(digest))
+		otherGen, err = primaryGen.WithResource(resource("s3cr3t-pass"))
+		g.Expect(err).To(Not(HaveOccurred()))
+		otherGen, err = otherGen.WithDefaults(map[string]interface{}{})
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(otherGen.InputsDigest()).To(Not(Equal(digest)))
+	}
+
+	{
+		// a single character secret only redacts the value, not every
+		// occurrence of the character
+		_, err := gen.WithResource(resource("e"))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(HavePrefix(`unable to fill path "resource": resource.spec.password: invalid value <redacted> (out of bound <redacted>)`))
+		g.Expect(err.Error()).To(Not(ContainSubstring(`"e"`)))
+
+		gen, err := gen.WithResource(map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "e"},
+			"spec":     map[string]interface{}{"password": "eeeeeeee"},
+		})
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		_, err = gen.RenderJSON()
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(HavePrefix("unable to render JSON: "))
+		g.Expect(err.Error()).To(ContainSubstring("template.stringData.username: incomplete value string"))
+		g.Expect(err.Error()).To(Not(ContainSubstring("eeeeeeee")))
+		g.Expect(gen.Redact(err).Error()).To(Equal(err.Error()))
+
+		fields, err := gen.Check()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(fields).To(ContainElement(IncompleteField{
+			Path:      "template.stringData.url",
+			Value:     "<redacted>",
+			DependsOn: []string{"resource.spec.username"},
+		}))
+
+		dump, err := gen.Dump()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(dump).To(Not(ContainSubstring("eeeeeeee")))
+		g.Expect(dump).To(ContainSubstring(`name: "e"`))
+		g.Expect(dump).To(ContainSubstring(`password: =~"^.{8,}$" @sensitive()`))
+	}
+
+	{
+		gen := New("./testassets/sensitive", WithSensitiveOutput())
+		g.Expect(gen.CompileAndValidate()).To(Succeed())
+
+		gen, err := gen.WithResource(resource("s3cr3t-pass"))
+		g.Expect(err).To(Not(HaveOccurred()))
+
+		data, err := gen.RenderJSON()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(string(data)).To(ContainSubstring(`"password":"s3cr3t-pass"`))
+		g.Expect(gen.Lineage()[0].Value).To(Equal(resource("s3cr3t-pass")))
+
+		dump, err := gen.Dump()
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(dump).To(Not(ContainSubstring("s3cr3t-pass")))
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package crd
+
+#Widget: {
+	apiVersion: "example.com/v1"
+	kind:       "Widget"
+	metadata: {
+		name:      string
+		namespace: string
+	}
+	spec: {
+		// Mode of operation
+		mode: *"Standard" | "Autopilot"
+		subnet: =~"^10\\."
+		replicas: int & >0 & <=10 | *3
+		ratio?: >=0.5 & <1
+		labels?: [string]: string
+		ports: [...{
+			name: string
+			port: int
+		}]
+		config?: {...}
+		paused:     bool | *false
+		owner?:     null | string
+		targetPort: int | string
+	}
+	status?: ready: bool
+}
+
+defaults: {}
+resource: #Widget
+
+template: {
+	kind:       "ConfigMap"
+	apiVersion: "v1"
+	metadata:   resource.metadata
+	data: mode: resource.spec.mode
+}
@@ -0,0 +1,78 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package hashes
+
+defaults: {}
+resource: {
+	name:      string
+	namespace: string
+	config: [string]: string
+}
+
+template: {
+	kind:       "List"
+	apiVersion: "v1"
+	items: [
+		{
+			apiVersion: "v1"
+			kind:       "ConfigMap"
+			metadata: {
+				name:      "\(resource.name)-config"
+				namespace: resource.namespace
+			}
+			data: resource.config
+		},
+		{
+			apiVersion: "v1"
+			kind:       "Secret"
+			metadata: {
+				name:      "\(resource.name)-credentials"
+				namespace: resource.namespace
+			}
+			stringData: password: "secret"
+		},
+		{
+			apiVersion: "apps/v1"
+			kind:       "Deployment"
+			metadata: {
+				name:      resource.name
+				namespace: resource.namespace
+			}
+			spec: template: spec: {
+				containers: [{
+					name:  "app"
+					image: "example.com/app:v1"
+					envFrom: [
+						{configMapRef: name: "\(resource.name)-config"},
+						{configMapRef: name: "external"},
+					]
+					env: [{
+						name: "PASSWORD"
+						valueFrom: secretKeyRef: {
+							name: "\(resource.name)-credentials"
+							key:  "password"
+						}
+					}]
+				}]
+				volumes: [
+					{
+						name: "config"
+						configMap: name: "\(resource.name)-config"
+					},
+					{
+						name: "credentials"
+						secret: secretName: "\(resource.name)-credentials"
+					},
+					{
+						name: "projected"
+						projected: sources: [
+							{configMap: name: "\(resource.name)-config"},
+							{secret: name: "\(resource.name)-credentials"},
+						]
+					},
+				]
+			}
+		},
+	]
+}
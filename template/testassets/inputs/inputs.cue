@@ -0,0 +1,37 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package inputs
+
+import "github.com/errordeveloper/cue-utils/template/testtypes"
+
+#slots: inputs: ["cluster", "environment", "featureFlags"]
+
+defaults: {}
+resource: testtypes.#Cluster
+
+cluster: {
+	name:   string
+	region: string
+}
+environment: "dev" | "staging" | "prod"
+featureFlags: [string]: bool
+
+template: {
+	kind:       "ConfigMap"
+	apiVersion: "v1"
+	metadata: {
+		namespace: resource.metadata.namespace
+		name:      resource.metadata.name
+		labels: {
+			"example.com/cluster":     cluster.name
+			"example.com/environment": environment
+		}
+	}
+	data: {
+		region: cluster.region
+		for flag, enabled in featureFlags if enabled {
+			"feature.\(flag)": "enabled"
+		}
+	}
+}
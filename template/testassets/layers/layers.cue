@@ -0,0 +1,37 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package layers
+
+#Defaults: {
+	region?:   string
+	replicas?: int & >0
+	tier:      *"silver" | "gold"
+	labels?: [string]: string
+	zones?: [...string]
+	settings?: _
+
+	if tier == "gold" {
+		replicas: >=3
+	}
+}
+
+defaults: #Defaults
+resource: {
+	name:      string
+	namespace: string
+}
+
+template: {
+	kind:       "ConfigMap"
+	apiVersion: "v1"
+	metadata: {
+		name:      resource.name
+		namespace: resource.namespace
+		labels:    defaults.labels
+	}
+	data: {
+		region:   defaults.region
+		replicas: "\(defaults.replicas)"
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package lists
+
+defaults: {}
+resource: {
+	name:      string
+	namespace: string
+}
+
+#metadata: {
+	name:      resource.name
+	namespace: resource.namespace
+}
+
+template: [
+	{
+		kind:       "List"
+		apiVersion: "v1"
+		items: [
+			{
+				kind:       "ConfigMap"
+				apiVersion: "v1"
+				metadata:   #metadata
+				data: foo:  "bar"
+			},
+			{
+				kind:       "List"
+				apiVersion: "v1"
+				items: [{
+					kind:       "Secret"
+					apiVersion: "v1"
+					metadata:   #metadata
+					stringData: foo: "bar"
+				}]
+			},
+		]
+	},
+	[{
+		kind:       "ServiceAccount"
+		apiVersion: "v1"
+		metadata:   #metadata
+	}],
+]
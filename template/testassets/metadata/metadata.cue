@@ -0,0 +1,31 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package metadata
+
+import "github.com/errordeveloper/cue-utils/template/testtypes"
+
+#meta: {
+	displayName: "Cluster config"
+	description: "Renders a ConfigMap with cluster location"
+	owner:       "platform-team"
+	version:     "1.2.0"
+	inputKind: {
+		apiVersion: "example.com/v1"
+		kind:       "Cluster"
+	}
+	tags: ["cluster", "gcp"]
+}
+
+defaults: {}
+resource: testtypes.#Cluster
+
+template: {
+	kind:       "ConfigMap"
+	apiVersion: "v1"
+	metadata: {
+		namespace: resource.metadata.namespace
+		name:      resource.metadata.name
+	}
+	data: location: resource.spec.location
+}
@@ -0,0 +1,61 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package ordering
+
+defaults: {}
+resource: {
+	name:      string
+	namespace: string
+}
+
+#metadata: {
+	name:      resource.name
+	namespace: resource.namespace
+	...
+}
+
+template: {
+	kind:       "List"
+	apiVersion: "v1"
+	items: [
+		{
+			apiVersion: "apps/v1"
+			kind:       "Deployment"
+			metadata:   #metadata
+		},
+		{
+			apiVersion: "compute.cnrm.cloud.google.com/v1beta1"
+			kind:       "ComputeSubnetwork"
+			metadata: #metadata & {
+				annotations: "config.kubernetes.io/depends-on": "compute.cnrm.cloud.google.com/namespaces/\(resource.namespace)/ComputeNetwork/\(resource.name)"
+			}
+			spec: networkRef: name: resource.name
+		},
+		{
+			apiVersion: "compute.cnrm.cloud.google.com/v1beta1"
+			kind:       "ComputeNetwork"
+			metadata:   #metadata
+		},
+		{
+			apiVersion: "rbac.authorization.k8s.io/v1"
+			kind:       "RoleBinding"
+			metadata:   #metadata
+		},
+		{
+			apiVersion: "v1"
+			kind:       "ServiceAccount"
+			metadata:   #metadata
+		},
+		{
+			apiVersion: "apiextensions.k8s.io/v1"
+			kind:       "CustomResourceDefinition"
+			metadata: name: "computenetworks.compute.cnrm.cloud.google.com"
+		},
+		{
+			apiVersion: "v1"
+			kind:       "Namespace"
+			metadata: name: resource.namespace
+		},
+	]
+}
@@ -0,0 +1,37 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package outputs
+
+defaults: {}
+resource: {
+	name:      string
+	namespace: string
+}
+
+outputs: [name=string]: _
+outputs: {
+	manifests: {
+		kind:       "List"
+		apiVersion: "v1"
+		items: [{
+			kind:       "Deployment"
+			apiVersion: "apps/v1"
+			metadata: {
+				name:      resource.name
+				namespace: resource.namespace
+			}
+		}]
+	}
+	dashboards: "\(resource.name).json": {
+		title: "\(resource.name) overview"
+		panels: []
+	}
+	alerts: groups: [{
+		name: resource.name
+		rules: [{
+			alert: "\(resource.name)Down"
+			expr:  "up{job=\"\(resource.name)\"} == 0"
+		}]
+	}]
+}
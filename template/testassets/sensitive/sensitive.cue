@@ -0,0 +1,30 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package sensitive
+
+#Credentials: {
+	username: string
+	password: string & =~"^.{8,}$" @sensitive()
+	port:     int | *5432
+}
+
+defaults: {}
+resource: {
+	metadata: name: string
+	spec: #Credentials
+}
+
+template: {
+	kind:       "Secret"
+	apiVersion: "v1"
+	metadata: {
+		name: resource.metadata.name
+		labels: app: "\(resource.metadata.name)-app"
+	}
+	stringData: {
+		username: resource.spec.username
+		password: resource.spec.password
+		url:      "postgres://\(resource.spec.username):\(resource.spec.password)@db:\(resource.spec.port)"
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package declared
+
+import "github.com/errordeveloper/cue-utils/template/testtypes"
+
+#slots: {
+	template: "output"
+	defaults: "params"
+	resource: "input"
+}
+
+params: testtypes.#Cluster
+input:  testtypes.#Cluster
+output: {
+	kind:       "ConfigMap"
+	apiVersion: "v1"
+	metadata: {
+		namespace: input.metadata.namespace
+		name:      input.metadata.name
+	}
+	data: location: input.spec.location
+}
@@ -0,0 +1,26 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package slots
+
+import "github.com/errordeveloper/cue-utils/template/testtypes"
+
+params: testtypes.#Cluster
+input:  testtypes.#Cluster
+output: {
+	kind:       "ConfigMap"
+	apiVersion: "v1"
+	metadata: {
+		namespace: input.metadata.namespace
+		name:      input.metadata.name
+	}
+	data: {
+		location: input.spec.location
+		if input.spec.subnetCIDR != _|_ {
+			subnetCIDR: input.spec.subnetCIDR
+		}
+		if input.spec.subnetCIDR == _|_ && params.spec.subnetCIDR != _|_ {
+			subnetCIDR: params.spec.subnetCIDR
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package transformers
+
+defaults: {}
+resource: {
+	name:      string
+	namespace: string
+	image:     string
+}
+
+#metadata: {
+	name:      resource.name
+	namespace: resource.namespace
+	labels: app: resource.name
+}
+
+#podSpec: {
+	initContainers: [{
+		name:  "init"
+		image: "docker.io/library/busybox:1.35"
+	}]
+	containers: [{
+		name:  "app"
+		image: resource.image
+	}]
+}
+
+template: {
+	kind:       "List"
+	apiVersion: "v1"
+	items: [
+		{
+			apiVersion: "v1"
+			kind:       "Namespace"
+			metadata: name: resource.namespace
+		},
+		{
+			apiVersion: "apps/v1"
+			kind:       "Deployment"
+			metadata:   #metadata
+			spec: template: spec: #podSpec
+		},
+		{
+			apiVersion: "batch/v1"
+			kind:       "CronJob"
+			metadata:   #metadata
+			spec: jobTemplate: spec: template: spec: #podSpec
+		},
+	]
+}
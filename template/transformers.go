@@ -0,0 +1,183 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package template
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Transformer modifies rendered objects, it may also add or remove objects
+type Transformer interface {
+	Transform(objs []unstructured.Unstructured) ([]unstructured.Unstructured, error)
+}
+
+// TransformerFunc is a function that implements Transformer
+type TransformerFunc func(objs []unstructured.Unstructured) ([]unstructured.Unstructured, error)
+
+func (f TransformerFunc) Transform(objs []unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+	return f(objs)
+}
+
+// WithTransformers adds transformers that RenderObjects applies, in the
+// given order, after any transformers that were added before
+func WithTransformers(transformers ...Transformer) Option {
+	return func(g *Generator) {
+		g.transformers = append(append([]Transformer{}, g.transformers...), transformers...)
+	}
+}
+
+func (g *Generator) transform(objs []unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+	for i, transformer := range g.transformers {
+		var err error
+		objs, err = transformer.Transform(objs)
+		if err != nil {
+			return nil, fmt.Errorf("transformer %d (%T) failed: %w", i, transformer, err)
+		}
+	}
+	return objs, nil
+}
+
+// eachObject returns a transformer that calls f for every object
+func eachObject(f func(obj *unstructured.Unstructured) error) Transformer {
+	return TransformerFunc(func(objs []unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+		for i := range objs {
+			if err := f(&objs[i]); err != nil {
+				return nil, fmt.Errorf("object %s: %w", objectID(&objs[i]), err)
+			}
+		}
+		return objs, nil
+	})
+}
+
+// SetLabels adds the given labels to metadata of every object, replacing
+// any existing values
+func SetLabels(labels map[string]string) Transformer {
+	return eachObject(func(obj *unstructured.Unstructured) error {
+		obj.SetLabels(merge(obj.GetLabels(), labels))
+		return nil
+	})
+}
+
+// SetAnnotations adds the given annotations to metadata of every object,
+// replacing any existing values
+func SetAnnotations(annotations map[string]string) Transformer {
+	return eachObject(func(obj *unstructured.Unstructured) error {
+		obj.SetAnnotations(merge(obj.GetAnnotations(), annotations))
+		return nil
+	})
+}
+
+func merge(existing, values map[string]string) map[string]string {
+	if existing == nil {
+		existing = make(map[string]string, len(values))
+	}
+	for k, v := range values {
+		existing[k] = v
+	}
+	return existing
+}
+
+// DefaultClusterScopedKinds are the built-in kinds that SetNamespace leaves
+// without a namespace, unless other kinds are given
+var DefaultClusterScopedKinds = []string{
+	"APIService",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"ComponentStatus",
+	"CSIDriver",
+	"CSINode",
+	"CustomResourceDefinition",
+	"IngressClass",
+	"MutatingWebhookConfiguration",
+	"Namespace",
+	"Node",
+	"PersistentVolume",
+	"PriorityClass",
+	"RuntimeClass",
+	"StorageClass",
+	"ValidatingWebhookConfiguration",
+	"VolumeAttachment",
+}
+
+// SetNamespace sets namespace of every object, whether it has one set or not,
+// except for objects of cluster-scoped kinds; DefaultClusterScopedKinds are
+// used when no kinds are given, custom cluster-scoped kinds need to be added
+// to these explicitly
+func SetNamespace(namespace string, clusterScopedKinds ...string) Transformer {
+	if len(clusterScopedKinds) == 0 {
+		clusterScopedKinds = DefaultClusterScopedKinds
+	}
+	clusterScoped := make(map[string]struct{}, len(clusterScopedKinds))
+	for _, kind := range clusterScopedKinds {
+		clusterScoped[kind] = struct{}{}
+	}
+	return eachObject(func(obj *unstructured.Unstructured) error {
+		if _, ok := clusterScoped[obj.GetKind()]; !ok {
+			obj.SetNamespace(namespace)
+		}
+		return nil
+	})
+}
+
+// AddOwnerReference adds the given owner reference to every object, unless
+// it already has an owner reference with the same UID
+func AddOwnerReference(ref metav1.OwnerReference) Transformer {
+	return eachObject(func(obj *unstructured.Unstructured) error {
+		refs := obj.GetOwnerReferences()
+		for _, existing := range refs {
+			if existing.UID == ref.UID {
+				return nil
+			}
+		}
+		obj.SetOwnerReferences(append(refs, ref))
+		return nil
+	})
+}
+
+// RewriteImageRegistry replaces registry prefix of container images, e.g.
+// "gcr.io/example" with "registry.example.com/mirror"; images of containers,
+// init containers and ephemeral containers are rewritten in any object
+func RewriteImageRegistry(from, to string) Transformer {
+	from = strings.TrimSuffix(from, "/")
+	to = strings.TrimSuffix(to, "/")
+	return eachObject(func(obj *unstructured.Unstructured) error {
+		rewriteImages(obj.Object, func(image string) string {
+			if strings.HasPrefix(image, from+"/") {
+				return to + strings.TrimPrefix(image, from)
+			}
+			return image
+		})
+		return nil
+	})
+}
+
+func rewriteImages(value interface{}, rewrite func(string) string) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for k, v := range value {
+			switch k {
+			case "containers", "initContainers", "ephemeralContainers":
+				if containers, ok := v.([]interface{}); ok {
+					for _, container := range containers {
+						if container, ok := container.(map[string]interface{}); ok {
+							if image, ok := container["image"].(string); ok {
+								container["image"] = rewrite(image)
+							}
+						}
+					}
+					continue
+				}
+			}
+			rewriteImages(v, rewrite)
+		}
+	case []interface{}:
+		for _, v := range value {
+			rewriteImages(v, rewrite)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2022 Ilya Dmitrichenko
+// SPDX-License-Identifier: Apache-2.0
+
+package template
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue"
+
+	"github.com/errordeveloper/cue-utils/errors"
+)
+
+// TypedGenerator wraps a generator, so that resources of type In are filled
+// and the template is rendered into a value of type Out
+type TypedGenerator[In, Out any] struct {
+	gen *Generator
+}
+
+// NewTypedGenerator checks that In is compatible with the resource definition
+// of the given generator, which must be compiled already; fields of In must
+// be allowed by the definition and have compatible types, and all required
+// fields of the definition must be present in In; map and interface types
+// cannot be checked, so these are always accepted
+func NewTypedGenerator[In, Out any](gen *Generator) (*TypedGenerator[In, Out], error) {
+	if err := gen.checkType(reflect.TypeOf((*In)(nil)).Elem()); err != nil {
+		return nil, err
+	}
+	return &TypedGenerator[In, Out]{gen: gen}, nil
+}
+
+// Generator returns the underlying generator
+func (t *TypedGenerator[In, Out]) Generator() *Generator { return t.gen }
+
+// Render fills the given resource and decodes the rendered template into Out,
+// or the named output if WithObjectsOutput is used; ctx is only checked before
+// rendering starts
+func (t *TypedGenerator[In, Out]) Render(ctx context.Context, in In) (Out, error) {
+	var out Out
+	if err := ctx.Err(); err != nil {
+		return out, err
+	}
+	gen, err := t.gen.WithResource(in)
+	if err != nil {
+		return out, err
+	}
+	var data []byte
+	if gen.objectsOutput != "" {
+		data, err = gen.Render(gen.objectsOutput)
+	} else {
+		data, err = gen.RenderJSON()
+	}
+	if err != nil {
+		return out, err
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return out, fmt.Errorf("unable to decode rendered JSON as %T: %w", out, err)
+	}
+	return out, nil
+}
+
+func (g *Generator) checkType(t reflect.Type) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Map || t.Kind() == reflect.Interface {
+		return nil
+	}
+
+	g.cue.LockMutex()
+	defer g.cue.UnlockMutex()
+
+	desc := fmt.Sprintf("type %s doesn't match %q", t, g.slots.Resource)
+
+	resource := g.Value.LookupPath(cue.ParsePath(g.slots.Resource))
+	if !resource.Exists() {
+		return fmt.Errorf("%s: not defined", desc)
+	}
+	typ := g.Value.Context().CompileString(typeOf(t, map[reflect.Type]bool{}))
+	if err := typ.Err(); err != nil {
+		return errors.Describe(fmt.Sprintf("unable to encode type %s", t), err)
+	}
+	val := resource.Unify(typ)
+	if err := val.Validate(); err != nil {
+		return errors.Describe(desc, errors.CollectFrom(val, g.cue.MaxErrors(), err))
+	}
+	if missing := missingFields(resource, typ, nil); len(missing) != 0 {
+		return fmt.Errorf("%s: required fields are missing: %v", desc, missing)
+	}
+	return nil
+}
+
+var marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// typeOf returns a CUE expression for the JSON encoding of the given type,
+// the same way values are filled; unlike cue.Context.EncodeType, inline and
+// embedded fields are flattened, and types with custom marshalling (e.g.
+// metav1.Time or intstr.IntOrString) as well as recursive types are accepted
+// as any value, since their encoding cannot be inferred
+func typeOf(t reflect.Type, seen map[reflect.Type]bool) string {
+	if t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType) {
+		return "_"
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return "null | " + typeOf(t.Elem(), seen)
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "int"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "int & >=0"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoded as base64
+			return "string"
+		}
+		return "null | [..." + typeOf(t.Elem(), seen) + "]"
+	case reflect.Map:
+		return "null | {[string]: " + typeOf(t.Elem(), seen) + "}"
+	case reflect.Struct:
+		if seen[t] {
+			return "_"
+		}
+		seen[t] = true
+		defer delete(seen, t)
+		fields := &strings.Builder{}
+		fields.WriteString("{")
+		structFields(t, seen, fields)
+		fields.WriteString("}")
+		return fields.String()
+	}
+	return "_"
+}
+
+// structFields writes fields of the given struct type, fields of inline and
+// embedded structs are written as fields of the outer one
+func structFields(t reflect.Type, seen map[reflect.Type]bool, fields *strings.Builder) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		inline := name == "" && (field.Anonymous || containsString(strings.Split(options, ","), "inline"))
+		if inline && fieldType.Kind() == reflect.Struct && !fieldType.Implements(marshalerType) && !reflect.PointerTo(fieldType).Implements(marshalerType) {
+			structFields(fieldType, seen, fields)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		// fields are never optional, so that closed definitions reject them
+		fmt.Fprintf(fields, "%s: %s\n", strconv.Quote(name), typeOf(field.Type, seen))
+	}
+}
+
+// missingFields lists required fields of def that are not present in typ
+func missingFields(def, typ cue.Value, path []cue.Selector) []string {
+	if def.IncompleteKind() != cue.StructKind || typ.IncompleteKind()&cue.StructKind == 0 {
+		return nil
+	}
+	iter, err := def.Fields()
+	if err != nil {
+		return nil
+	}
+	missing := []string{}
+	for iter.Next() {
+		fieldPath := append(append([]cue.Selector{}, path...), iter.Selector())
+		field := typ.LookupPath(cue.MakePath(iter.Selector()))
+		if !field.Exists() {
+			missing = append(missing, cue.MakePath(fieldPath...).String())
+			continue
+		}
+		missing = append(missing, missingFields(iter.Value(), field, fieldPath)...)
+	}
+	return missing
+}